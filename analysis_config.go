@@ -0,0 +1,685 @@
+package stalefish
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/kotaroooo0/stalefish/morphology"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownAnalysisComponent = errors.New("unknown analysis component")
+	ErrInvalidAnalysisConfig    = errors.New("invalid analysis config")
+)
+
+// アナライザの設定ファイルの形式
+type AnalysisConfigFormat int
+
+const (
+	AnalysisConfigFormatJSON AnalysisConfigFormat = iota + 1
+	AnalysisConfigFormatYAML
+)
+
+// アナライザの設定
+// Elasticsearchのindex.analysisと同じように、名前を付けたCharFilter、Tokenizer、TokenFilterを定義し、アナライザから名前で参照する
+// 各要素の定義は"type"で種類を指定し、残りのキーをパラメータとする
+// アナライザからは定義していない種類の名前も参照でき、その種類をデフォルトのパラメータで使う
+//
+//	char_filter:
+//	  emoticons:
+//	    type: mapping
+//	    mappings: {":(": "sad"}
+//	analyzer:
+//	  english:
+//	    char_filter: [html_strip, emoticons]
+//	    tokenizer: standard
+//	    filter: [lowercase, stemmer]
+type AnalysisConfig struct {
+	CharFilters  map[string]json.RawMessage `json:"char_filter"`
+	Tokenizers   map[string]json.RawMessage `json:"tokenizer"`
+	TokenFilters map[string]json.RawMessage `json:"filter"`
+	Analyzers    map[string]AnalyzerConfig  `json:"analyzer"`
+}
+
+type AnalyzerConfig struct {
+	CharFilters  []string `json:"char_filter"`
+	Tokenizer    string   `json:"tokenizer"`
+	TokenFilters []string `json:"filter"`
+}
+
+// アナライザの設定ファイルを読み込む
+func LoadAnalysisConfig(path string, format AnalysisConfigFormat) (AnalysisConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return AnalysisConfig{}, err
+	}
+	defer f.Close()
+	return ParseAnalysisConfig(f, format)
+}
+
+// YAMLはJSONに変換してから読み込むので、パラメータはどちらの形式でも同じように扱える
+func ParseAnalysisConfig(r io.Reader, format AnalysisConfigFormat) (AnalysisConfig, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return AnalysisConfig{}, err
+	}
+	switch format {
+	case AnalysisConfigFormatJSON:
+	case AnalysisConfigFormatYAML:
+		if b, err = yamlToJSON(b); err != nil {
+			return AnalysisConfig{}, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+		}
+	default:
+		return AnalysisConfig{}, fmt.Errorf("unknown analysis config format: %d", format)
+	}
+	var config AnalysisConfig
+	if err := decodeStrict(b, &config); err != nil {
+		return AnalysisConfig{}, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+	}
+	return config, nil
+}
+
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	v, err := jsonCompatible(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// キーが文字列でないマップ(map[interface{}]interface{})を、JSONに変換できるmap[string]interface{}にする
+func jsonCompatible(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			var err error
+			if v[k], err = jsonCompatible(e); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			var err error
+			if m[fmt.Sprint(k)], err = jsonCompatible(e); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i, e := range v {
+			var err error
+			if v[i], err = jsonCompatible(e); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	}
+	return v, nil
+}
+
+func decodeStrict(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+// 設定のパラメータからCharFilter、Tokenizer、TokenFilterを作る関数
+// paramsは"type"を除いた定義で、定義せずに参照した時は空のオブジェクト
+type CharFilterFactory func(params json.RawMessage) (CharFilter, error)
+type TokenizerFactory func(params json.RawMessage) (Tokenizer, error)
+type TokenFilterFactory func(params json.RawMessage) (TokenFilter, error)
+
+// 種類の名前からCharFilter、Tokenizer、TokenFilterを作る関数を引く
+type AnalysisRegistry struct {
+	charFilters  map[string]CharFilterFactory
+	tokenizers   map[string]TokenizerFactory
+	tokenFilters map[string]TokenFilterFactory
+}
+
+// 組み込みのCharFilter、Tokenizer、TokenFilterを登録したレジストリを返す
+func NewAnalysisRegistry() *AnalysisRegistry {
+	r := &AnalysisRegistry{
+		charFilters:  make(map[string]CharFilterFactory),
+		tokenizers:   make(map[string]TokenizerFactory),
+		tokenFilters: make(map[string]TokenFilterFactory),
+	}
+	registerBuiltinCharFilters(r)
+	registerBuiltinTokenizers(r)
+	registerBuiltinTokenFilters(r)
+	return r
+}
+
+// 同じ名前の種類があれば置き換える
+func (r *AnalysisRegistry) RegisterCharFilter(typ string, factory CharFilterFactory) {
+	r.charFilters[typ] = factory
+}
+
+func (r *AnalysisRegistry) RegisterTokenizer(typ string, factory TokenizerFactory) {
+	r.tokenizers[typ] = factory
+}
+
+func (r *AnalysisRegistry) RegisterTokenFilter(typ string, factory TokenFilterFactory) {
+	r.tokenFilters[typ] = factory
+}
+
+// 設定の全てのアナライザを作り、名前からアナライザへの対応を返す
+// 同じ名前の要素は一度だけ作り、アナライザ間で共有する
+func (r *AnalysisRegistry) Build(config AnalysisConfig) (map[string]Analyzer, error) {
+	b := analysisBuilder{
+		registry:     r,
+		config:       config,
+		charFilters:  make(map[string]CharFilter),
+		tokenizers:   make(map[string]Tokenizer),
+		tokenFilters: make(map[string]TokenFilter),
+	}
+	analyzers := make(map[string]Analyzer, len(config.Analyzers))
+	for name, ac := range config.Analyzers {
+		analyzer, err := b.analyzer(ac)
+		if err != nil {
+			return nil, fmt.Errorf("analyzer %q: %w", name, err)
+		}
+		analyzers[name] = analyzer
+	}
+	return analyzers, nil
+}
+
+type analysisBuilder struct {
+	registry     *AnalysisRegistry
+	config       AnalysisConfig
+	charFilters  map[string]CharFilter
+	tokenizers   map[string]Tokenizer
+	tokenFilters map[string]TokenFilter
+}
+
+func (b analysisBuilder) analyzer(ac AnalyzerConfig) (Analyzer, error) {
+	if ac.Tokenizer == "" {
+		return Analyzer{}, fmt.Errorf("%w: tokenizer is required", ErrInvalidAnalysisConfig)
+	}
+	charFilters := make([]CharFilter, len(ac.CharFilters))
+	for i, name := range ac.CharFilters {
+		c, err := b.charFilter(name)
+		if err != nil {
+			return Analyzer{}, err
+		}
+		charFilters[i] = c
+	}
+	tokenizer, err := b.tokenizer(ac.Tokenizer)
+	if err != nil {
+		return Analyzer{}, err
+	}
+	tokenFilters := make([]TokenFilter, len(ac.TokenFilters))
+	for i, name := range ac.TokenFilters {
+		f, err := b.tokenFilter(name)
+		if err != nil {
+			return Analyzer{}, err
+		}
+		tokenFilters[i] = f
+	}
+	return NewAnalyzer(charFilters, tokenizer, tokenFilters), nil
+}
+
+func (b analysisBuilder) charFilter(name string) (CharFilter, error) {
+	if c, ok := b.charFilters[name]; ok {
+		return c, nil
+	}
+	typ, params, err := componentType(name, b.config.CharFilters)
+	if err != nil {
+		return nil, fmt.Errorf("char_filter %q: %w", name, err)
+	}
+	factory, ok := b.registry.charFilters[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: char_filter %q", ErrUnknownAnalysisComponent, typ)
+	}
+	c, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("char_filter %q: %w", name, err)
+	}
+	b.charFilters[name] = c
+	return c, nil
+}
+
+func (b analysisBuilder) tokenizer(name string) (Tokenizer, error) {
+	if t, ok := b.tokenizers[name]; ok {
+		return t, nil
+	}
+	typ, params, err := componentType(name, b.config.Tokenizers)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer %q: %w", name, err)
+	}
+	factory, ok := b.registry.tokenizers[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: tokenizer %q", ErrUnknownAnalysisComponent, typ)
+	}
+	t, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer %q: %w", name, err)
+	}
+	b.tokenizers[name] = t
+	return t, nil
+}
+
+func (b analysisBuilder) tokenFilter(name string) (TokenFilter, error) {
+	if f, ok := b.tokenFilters[name]; ok {
+		return f, nil
+	}
+	typ, params, err := componentType(name, b.config.TokenFilters)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", name, err)
+	}
+	factory, ok := b.registry.tokenFilters[typ]
+	if !ok {
+		return nil, fmt.Errorf("%w: filter %q", ErrUnknownAnalysisComponent, typ)
+	}
+	f, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", name, err)
+	}
+	b.tokenFilters[name] = f
+	return f, nil
+}
+
+// 名前で定義した要素の種類と"type"を除いたパラメータを返す
+// 定義していなければ名前を種類とし、パラメータは空にする
+func componentType(name string, definitions map[string]json.RawMessage) (string, json.RawMessage, error) {
+	definition, ok := definitions[name]
+	if !ok {
+		return name, json.RawMessage("{}"), nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(definition, &fields); err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+	}
+	var typ string
+	if err := json.Unmarshal(fields["type"], &typ); err != nil || typ == "" {
+		return "", nil, fmt.Errorf("%w: type is required", ErrInvalidAnalysisConfig)
+	}
+	delete(fields, "type")
+	params, err := json.Marshal(fields)
+	if err != nil {
+		return "", nil, err
+	}
+	return typ, params, nil
+}
+
+// パラメータを構造体に読み込む
+// 知らないパラメータがあればエラーにする
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := decodeStrict(params, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+	}
+	return nil
+}
+
+func registerBuiltinCharFilters(r *AnalysisRegistry) {
+	r.RegisterCharFilter("mapping", func(params json.RawMessage) (CharFilter, error) {
+		var p struct {
+			Mappings map[string]string `json:"mappings"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewMappingCharFilter(p.Mappings), nil
+	})
+	r.RegisterCharFilter("pattern_replace", func(params json.RawMessage) (CharFilter, error) {
+		var p struct {
+			Pattern     string `json:"pattern"`
+			Replacement string `json:"replacement"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+		}
+		return NewPatternReplaceCharFilter(pattern, p.Replacement), nil
+	})
+	r.RegisterCharFilter("normalization", func(params json.RawMessage) (CharFilter, error) {
+		p := struct {
+			Form string `json:"form"`
+		}{Form: "nfkc_cf"}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		forms := map[string]NormalizationForm{"nfc": NFC, "nfkc": NFKC, "nfkc_cf": NFKCCasefold}
+		form, ok := forms[p.Form]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown normalization form %q", ErrInvalidAnalysisConfig, p.Form)
+		}
+		return NewNormalizationCharFilter(form), nil
+	})
+	r.RegisterCharFilter("html_strip", func(params json.RawMessage) (CharFilter, error) {
+		if err := decodeParams(params, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return NewHTMLStripCharFilter(), nil
+	})
+	r.RegisterCharFilter("japanese_iteration_mark", func(params json.RawMessage) (CharFilter, error) {
+		if err := decodeParams(params, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return NewJapaneseIterationMarkCharFilter(), nil
+	})
+}
+
+func registerBuiltinTokenizers(r *AnalysisRegistry) {
+	r.RegisterTokenizer("standard", func(params json.RawMessage) (Tokenizer, error) {
+		if err := decodeParams(params, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return NewStandardTokenizer(), nil
+	})
+	r.RegisterTokenizer("kagome", func(params json.RawMessage) (Tokenizer, error) {
+		var p kagomeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		kagome, err := p.kagome()
+		if err != nil {
+			return nil, err
+		}
+		return NewMorphologicalTokenizer(kagome), nil
+	})
+	r.RegisterTokenizer("reading_ngram", func(params json.RawMessage) (Tokenizer, error) {
+		p := struct {
+			kagomeParams
+			Form string `json:"form"`
+			N    int    `json:"n"`
+		}{Form: "kana", N: 2}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		forms := map[string]ReadingForm{"kana": ReadingFormKana, "romaji": ReadingFormRomaji}
+		form, ok := forms[p.Form]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown form %q", ErrInvalidAnalysisConfig, p.Form)
+		}
+		if p.N < 1 {
+			return nil, fmt.Errorf("%w: n must be positive", ErrInvalidAnalysisConfig)
+		}
+		kagome, err := p.kagome()
+		if err != nil {
+			return nil, err
+		}
+		return NewReadingNgramTokenizer(kagome, form, p.N), nil
+	})
+	r.RegisterTokenizer("ngram", func(params json.RawMessage) (Tokenizer, error) {
+		p := struct {
+			N int `json:"n"`
+		}{N: 2}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.N < 1 {
+			return nil, fmt.Errorf("%w: n must be positive", ErrInvalidAnalysisConfig)
+		}
+		return NewNgramTokenizer(p.N), nil
+	})
+	r.RegisterTokenizer("edge_ngram", func(params json.RawMessage) (Tokenizer, error) {
+		p := edgeNgramParams{MinGram: 1, MaxGram: 2, Side: "front"}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		side, err := p.side()
+		if err != nil {
+			return nil, err
+		}
+		return NewEdgeNgramTokenizer(p.MinGram, p.MaxGram, side), nil
+	})
+	r.RegisterTokenizer("cjk_bigram", func(params json.RawMessage) (Tokenizer, error) {
+		if err := decodeParams(params, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return NewCJKBigramTokenizer(), nil
+	})
+	r.RegisterTokenizer("pattern", func(params json.RawMessage) (Tokenizer, error) {
+		p := struct {
+			Pattern string `json:"pattern"`
+			Group   int    `json:"group"`
+		}{Pattern: `\W+`, Group: -1}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+		}
+		return NewPatternTokenizer(pattern, p.Group), nil
+	})
+}
+
+type kagomeParams struct {
+	Dictionary     string `json:"dictionary"`
+	Mode           string `json:"mode"`
+	UserDictionary string `json:"user_dictionary"`
+}
+
+func (p kagomeParams) kagome() (*morphology.Kagome, error) {
+	options := make([]morphology.KagomeOption, 0)
+	if p.Dictionary != "" {
+		// NEologd以外の辞書はmorphology/ipa等のパッケージをインポートすると登録される
+		dictionary, err := morphology.LookupDictionary(p.Dictionary)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+		}
+		options = append(options, morphology.WithDictionary(dictionary))
+	}
+	if p.Mode != "" {
+		modes := map[string]morphology.Mode{"normal": morphology.Normal, "search": morphology.Search, "extended": morphology.Extended}
+		mode, ok := modes[p.Mode]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidAnalysisConfig, p.Mode)
+		}
+		options = append(options, morphology.WithMode(mode))
+	}
+	if p.UserDictionary != "" {
+		options = append(options, morphology.WithUserDictionary(p.UserDictionary))
+	}
+	kagome, err := morphology.NewKagome(options...)
+	if errors.Is(err, morphology.ErrDictionaryNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAnalysisConfig, err)
+	}
+	return kagome, err
+}
+
+type edgeNgramParams struct {
+	MinGram int    `json:"min_gram"`
+	MaxGram int    `json:"max_gram"`
+	Side    string `json:"side"`
+}
+
+func (p edgeNgramParams) side() (EdgeNgramSide, error) {
+	switch p.Side {
+	case "front":
+		return EdgeNgramFront, nil
+	case "back":
+		return EdgeNgramBack, nil
+	}
+	return 0, fmt.Errorf("%w: unknown side %q", ErrInvalidAnalysisConfig, p.Side)
+}
+
+func registerBuiltinTokenFilters(r *AnalysisRegistry) {
+	noParams := func(f TokenFilter) TokenFilterFactory {
+		return func(params json.RawMessage) (TokenFilter, error) {
+			if err := decodeParams(params, &struct{}{}); err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+	}
+	r.RegisterTokenFilter("lowercase", noParams(NewLowercaseFilter()))
+	r.RegisterTokenFilter("romaji_readingform", noParams(NewRomajiReadingformFilter()))
+	r.RegisterTokenFilter("kana_readingform", noParams(NewKanaReadingformFilter()))
+	r.RegisterTokenFilter("width_folding", noParams(NewWidthFoldingFilter()))
+	r.RegisterTokenFilter("japanese_base_form", noParams(NewJapaneseBaseFormFilter()))
+	r.RegisterTokenFilter("ascii_folding", noParams(NewASCIIFoldingFilter()))
+	r.RegisterTokenFilter("trim", noParams(NewTrimFilter()))
+
+	// stopwordsを指定しなければlanguageのデフォルトのストップワードを使う
+	r.RegisterTokenFilter("stop", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			Stopwords []string `json:"stopwords"`
+			Language  Language `json:"language"`
+		}{Language: English}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if p.Stopwords == nil {
+			p.Stopwords = DefaultStopWords(p.Language)
+			if p.Stopwords == nil {
+				return nil, fmt.Errorf("%w: no default stopwords for %q", ErrInvalidAnalysisConfig, p.Language)
+			}
+		}
+		return NewStopWordFilter(p.Stopwords), nil
+	})
+	r.RegisterTokenFilter("stemmer", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			Language Language `json:"language"`
+		}{Language: English}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if _, ok := snowballStemmers[p.Language]; !ok {
+			return nil, fmt.Errorf("%w: unsupported stemmer language %q", ErrInvalidAnalysisConfig, p.Language)
+		}
+		return NewSnowballStemmerFilter(p.Language), nil
+	})
+	r.RegisterTokenFilter("keyword_marker", func(params json.RawMessage) (TokenFilter, error) {
+		var p struct {
+			Keywords []string `json:"keywords"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewKeywordMarkerFilter(p.Keywords), nil
+	})
+	r.RegisterTokenFilter("edge_ngram", func(params json.RawMessage) (TokenFilter, error) {
+		p := edgeNgramParams{MinGram: 1, MaxGram: 2, Side: "front"}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		side, err := p.side()
+		if err != nil {
+			return nil, err
+		}
+		return NewEdgeNgramFilter(p.MinGram, p.MaxGram, side), nil
+	})
+	r.RegisterTokenFilter("japanese_pos_stop", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			StopTags []string `json:"stoptags"`
+		}{StopTags: DefaultJapanesePOSStopTags}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewJapanesePOSStopFilter(p.StopTags), nil
+	})
+	r.RegisterTokenFilter("japanese_katakana_stem", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			MinimumLength int `json:"minimum_length"`
+		}{MinimumLength: DefaultKatakanaStemMinLength}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewJapaneseKatakanaStemFilter(p.MinimumLength), nil
+	})
+	// synonymsは"a, b => c"形式の行、synonyms_pathは定義ファイルのパス
+	r.RegisterTokenFilter("synonym", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			Synonyms     []string `json:"synonyms"`
+			SynonymsPath string   `json:"synonyms_path"`
+			Format       string   `json:"format"`
+			Expand       bool     `json:"expand"`
+		}{Format: "solr", Expand: true}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		formats := map[string]SynonymFormat{"solr": SynonymFormatSolr, "wordnet": SynonymFormatWordNet}
+		format, ok := formats[p.Format]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown synonym format %q", ErrInvalidAnalysisConfig, p.Format)
+		}
+		var synonyms *SynonymMap
+		var err error
+		if p.SynonymsPath != "" {
+			synonyms, err = LoadSynonyms(p.SynonymsPath, format, p.Expand)
+		} else {
+			synonyms, err = ParseSynonyms(strings.NewReader(strings.Join(p.Synonyms, "\n")), format, p.Expand)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NewSynonymFilter(synonyms), nil
+	})
+	r.RegisterTokenFilter("shingle", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			MinShingleSize int    `json:"min_shingle_size"`
+			MaxShingleSize int    `json:"max_shingle_size"`
+			TokenSeparator string `json:"token_separator"`
+			OutputUnigrams bool   `json:"output_unigrams"`
+		}{MinShingleSize: 2, MaxShingleSize: 2, TokenSeparator: " ", OutputUnigrams: true}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewShingleFilter(p.MinShingleSize, p.MaxShingleSize, p.TokenSeparator, p.OutputUnigrams), nil
+	})
+	r.RegisterTokenFilter("length", func(params json.RawMessage) (TokenFilter, error) {
+		var p struct {
+			Min int `json:"min"`
+			Max int `json:"max"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewLengthFilter(p.Min, p.Max), nil
+	})
+	r.RegisterTokenFilter("unique", func(params json.RawMessage) (TokenFilter, error) {
+		var p struct {
+			OnlyOnSamePosition bool `json:"only_on_same_position"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return NewUniqueFilter(p.OnlyOnSamePosition), nil
+	})
+	r.RegisterTokenFilter("word_delimiter", func(params json.RawMessage) (TokenFilter, error) {
+		p := struct {
+			SplitOnCaseChange bool `json:"split_on_case_change"`
+			SplitOnNumerics   bool `json:"split_on_numerics"`
+			CatenateWords     bool `json:"catenate_words"`
+			CatenateNumbers   bool `json:"catenate_numbers"`
+			CatenateAll       bool `json:"catenate_all"`
+			PreserveOriginal  bool `json:"preserve_original"`
+		}{SplitOnCaseChange: true, SplitOnNumerics: true}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		options := []WordDelimiterOption{WithSplitOnCaseChange(p.SplitOnCaseChange), WithSplitOnNumerics(p.SplitOnNumerics)}
+		if p.CatenateWords {
+			options = append(options, WithCatenateWords())
+		}
+		if p.CatenateNumbers {
+			options = append(options, WithCatenateNumbers())
+		}
+		if p.CatenateAll {
+			options = append(options, WithCatenateAll())
+		}
+		if p.PreserveOriginal {
+			options = append(options, WithPreserveOriginal())
+		}
+		return NewWordDelimiterFilter(options...), nil
+	})
+}
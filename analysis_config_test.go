@@ -0,0 +1,240 @@
+package stalefish
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testAnalysisConfigYAML = `
+char_filter:
+  emoticons:
+    type: mapping
+    mappings:
+      ":(": sad
+tokenizer:
+  bigram:
+    type: ngram
+    n: 2
+filter:
+  english_stop:
+    type: stop
+    stopwords: [i, my, me, the, a, for]
+  french_stemmer:
+    type: stemmer
+    language: french
+  car_synonyms:
+    type: synonym
+    synonyms:
+      - "car, automobile"
+analyzer:
+  english:
+    char_filter: [html_strip, emoticons]
+    tokenizer: standard
+    filter: [lowercase, stemmer, english_stop]
+  french:
+    tokenizer: standard
+    filter: [lowercase, french_stemmer]
+  bigram:
+    tokenizer: bigram
+  synonym:
+    tokenizer: standard
+    filter: [lowercase, car_synonyms]
+`
+
+const testAnalysisConfigJSON = `{
+  "char_filter": {"emoticons": {"type": "mapping", "mappings": {":(": "sad"}}},
+  "tokenizer": {"bigram": {"type": "ngram", "n": 2}},
+  "filter": {
+    "english_stop": {"type": "stop", "stopwords": ["i", "my", "me", "the", "a", "for"]},
+    "french_stemmer": {"type": "stemmer", "language": "french"},
+    "car_synonyms": {"type": "synonym", "synonyms": ["car, automobile"]}
+  },
+  "analyzer": {
+    "english": {"char_filter": ["html_strip", "emoticons"], "tokenizer": "standard", "filter": ["lowercase", "stemmer", "english_stop"]},
+    "french": {"tokenizer": "standard", "filter": ["lowercase", "french_stemmer"]},
+    "bigram": {"tokenizer": "bigram"},
+    "synonym": {"tokenizer": "standard", "filter": ["lowercase", "car_synonyms"]}
+  }
+}`
+
+func TestAnalysisRegistry_Build(t *testing.T) {
+	cases := []struct {
+		format AnalysisConfigFormat
+		config string
+	}{
+		{format: AnalysisConfigFormatYAML, config: testAnalysisConfigYAML},
+		{format: AnalysisConfigFormatJSON, config: testAnalysisConfigJSON},
+	}
+	expected := []struct {
+		analyzer string
+		text     string
+		terms    []string
+	}{
+		{analyzer: "english", text: "<p>I feel TIRED :(</p>", terms: []string{"feel", "tire", "sad"}},
+		{analyzer: "french", text: "Les chats continuellement", terms: []string{"le", "chat", "continuel"}},
+		{analyzer: "bigram", text: "abc", terms: []string{"ab", "bc"}},
+		{analyzer: "synonym", text: "Red car", terms: []string{"red", "car", "automobile"}},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("format = %v", tt.format), func(t *testing.T) {
+			config, err := ParseAnalysisConfig(strings.NewReader(tt.config), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			analyzers, err := NewAnalysisRegistry().Build(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(analyzers) != len(expected) {
+				t.Errorf("len(analyzers) = %v, want %v", len(analyzers), len(expected))
+			}
+			for _, e := range expected {
+				analyzer, ok := analyzers[e.analyzer]
+				if !ok {
+					t.Fatalf("analyzer %q not found", e.analyzer)
+				}
+				if diff := cmp.Diff(analyzer.Analyze(e.text).Terms(), e.terms); diff != "" {
+					t.Errorf("analyzer = %v, Diff: (-got +want)\n%s", e.analyzer, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalysisRegistry_Build_Error(t *testing.T) {
+	cases := []struct {
+		config   string
+		expected error
+	}{
+		{
+			config:   `{"analyzer": {"a": {"tokenizer": "unknown"}}}`,
+			expected: ErrUnknownAnalysisComponent,
+		},
+		{
+			config:   `{"analyzer": {"a": {"tokenizer": "standard", "filter": ["unknown"]}}}`,
+			expected: ErrUnknownAnalysisComponent,
+		},
+		{
+			config:   `{"analyzer": {"a": {"filter": ["lowercase"]}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"tokenizer": {"t": {"n": 2}}, "analyzer": {"a": {"tokenizer": "t"}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"tokenizer": {"t": {"type": "ngram", "size": 2}}, "analyzer": {"a": {"tokenizer": "t"}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"tokenizer": {"t": {"type": "reading_ngram", "n": 0}}, "analyzer": {"a": {"tokenizer": "t"}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"tokenizer": {"t": {"type": "reading_ngram", "form": "katakana"}}, "analyzer": {"a": {"tokenizer": "t"}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"tokenizer": {"t": {"type": "reading_ngram", "dictionary": "unknown"}}, "analyzer": {"a": {"tokenizer": "t"}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"filter": {"f": {"type": "stemmer", "language": "klingon"}}, "analyzer": {"a": {"tokenizer": "standard", "filter": ["f"]}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+		{
+			config:   `{"char_filter": {"c": {"type": "pattern_replace", "pattern": "("}}, "analyzer": {"a": {"char_filter": ["c"], "tokenizer": "standard"}}}`,
+			expected: ErrInvalidAnalysisConfig,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("config = %v, expected = %v", tt.config, tt.expected), func(t *testing.T) {
+			config, err := ParseAnalysisConfig(strings.NewReader(tt.config), AnalysisConfigFormatJSON)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewAnalysisRegistry().Build(config); !errors.Is(err, tt.expected) {
+				t.Errorf("AnalysisRegistry.Build() error = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseAnalysisConfig_Error(t *testing.T) {
+	cases := []struct {
+		format AnalysisConfigFormat
+		config string
+	}{
+		{format: AnalysisConfigFormatJSON, config: `{"analyzers": {}}`},
+		{format: AnalysisConfigFormatJSON, config: `{`},
+		{format: AnalysisConfigFormatYAML, config: "analyzer: [\n"},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("format = %v, config = %v", tt.format, tt.config), func(t *testing.T) {
+			if _, err := ParseAnalysisConfig(strings.NewReader(tt.config), tt.format); !errors.Is(err, ErrInvalidAnalysisConfig) {
+				t.Errorf("ParseAnalysisConfig() error = %v, want %v", err, ErrInvalidAnalysisConfig)
+			}
+		})
+	}
+}
+
+func TestAnalysisRegistry_Register(t *testing.T) {
+	registry := NewAnalysisRegistry()
+	registry.RegisterTokenFilter("prefix", func(params json.RawMessage) (TokenFilter, error) {
+		var p struct {
+			Prefix string `json:"prefix"`
+		}
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return prefixFilter{prefix: p.Prefix}, nil
+	})
+
+	dir, err := ioutil.TempDir("", "analysis_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "analysis.yml")
+	config := "filter:\n  hash:\n    type: prefix\n    prefix: \"#\"\nanalyzer:\n  tags:\n    tokenizer: standard\n    filter: [hash]\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadAnalysisConfig(path, AnalysisConfigFormatYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzers, err := registry.Build(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(analyzers["tags"].Analyze("go search").Terms(), []string{"#go", "#search"}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+// 語句の先頭に文字列を付けるテスト用のTokenFilter
+type prefixFilter struct {
+	prefix string
+}
+
+func (f prefixFilter) Filter(tokenStream TokenStream) TokenStream {
+	r := make([]Token, tokenStream.Size())
+	for i, token := range tokenStream.Tokens {
+		token.Term = f.prefix + token.Term
+		r[i] = token
+	}
+	return NewTokenStream(r)
+}
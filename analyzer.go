@@ -1,5 +1,11 @@
 package stalefish
 
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
 type Analyzer struct {
 	charFilters  []CharFilter
 	tokenizer    Tokenizer
@@ -14,13 +20,243 @@ func NewAnalyzer(charFilters []CharFilter, tokenizer Tokenizer, tokenFilters []T
 	}
 }
 
+// トークンのオフセットは元の文字列中の位置を指す
+// ただしOffsetCorrectingCharFilterを満たさないCharFilterによる変換は補正されない
 func (a Analyzer) Analyze(s string) TokenStream {
-	for _, c := range a.charFilters {
-		s = c.Filter(s)
-	}
+	return a.analyze(s, nil)
+}
+
+// explanationがnilでなければ、各段階の結果を記録する
+func (a Analyzer) analyze(s string, explanation *Analysis) TokenStream {
+	s, correctors := a.filterChars(s, explanation)
 	tokenStream := a.tokenizer.Tokenize(s)
+	correctOffsets(tokenStream, correctors)
+	if explanation != nil {
+		explanation.Tokenizer = newTokenStreamAnalysis(componentName(a.tokenizer), tokenStream)
+	}
 	for _, f := range a.tokenFilters {
 		tokenStream = f.Filter(tokenStream)
+		if explanation != nil {
+			explanation.TokenFilters = append(explanation.TokenFilters, newTokenStreamAnalysis(componentName(f), tokenStream))
+		}
 	}
 	return tokenStream
 }
+
+// 解析の各段階の結果を返す
+// 検索でヒットしない原因を調べる時に使う
+func (a Analyzer) Explain(s string) Analysis {
+	if t, ok := a.tokenizer.(languageRoutingTokenizer); ok {
+		return t.explain(s)
+	}
+	explanation := Analysis{Text: s, CharFilters: []CharFilterAnalysis{}, TokenFilters: []TokenStreamAnalysis{}}
+	a.analyze(s, &explanation)
+	return explanation
+}
+
+// Analyzeと同じトークンを1つずつ返す
+// StreamingTokenizerとStreamingTokenFilterは全てのトークンをスライスにせずに処理するので、大きな文字列の解析に使う
+// CharFilterはストリーミングせずに文字列全体に適用してからトークナイザに渡すので、
+// CharFilterがあれば変換した文字列全体とオフセットの補正に使う対応表をメモリに置く
+func (a Analyzer) AnalyzeIterator(s string) TokenIterator {
+	s, correctors := a.filterChars(s, nil)
+	it := tokenizeIterator(a.tokenizer, s)
+	if len(correctors) > 0 {
+		it = &offsetCorrectingTokenIterator{source: it, correctors: correctors}
+	}
+	for _, f := range a.tokenFilters {
+		it = filterIterator(f, it)
+	}
+	return it
+}
+
+// CharFilterを順に適用し、オフセットを補正するOffsetCorrectorを返す
+func (a Analyzer) filterChars(s string, explanation *Analysis) (string, []OffsetCorrector) {
+	correctors := make([]OffsetCorrector, 0, len(a.charFilters))
+	for _, c := range a.charFilters {
+		if oc, ok := c.(OffsetCorrectingCharFilter); ok {
+			var corrector OffsetCorrector
+			s, corrector = oc.FilterWithOffsets(s)
+			correctors = append(correctors, corrector)
+		} else {
+			s = c.Filter(s)
+		}
+		if explanation != nil {
+			explanation.CharFilters = append(explanation.CharFilters, CharFilterAnalysis{Name: componentName(c), Text: s})
+		}
+	}
+	return s, correctors
+}
+
+func correctOffsets(tokenStream TokenStream, correctors []OffsetCorrector) {
+	if len(correctors) == 0 {
+		return
+	}
+	for i, token := range tokenStream.Tokens {
+		tokenStream.Tokens[i] = correctOffset(token, correctors)
+	}
+}
+
+// CharFilterを適用した順と逆順に補正し、元の文字列中の位置に戻す
+func correctOffset(token Token, correctors []OffsetCorrector) Token {
+	for j := len(correctors) - 1; j >= 0; j-- {
+		token.Start = correctors[j].Correct(token.Start)
+		token.End = correctors[j].CorrectEnd(token.End)
+	}
+	return token
+}
+
+type offsetCorrectingTokenIterator struct {
+	source     TokenIterator
+	correctors []OffsetCorrector
+}
+
+func (it *offsetCorrectingTokenIterator) Next() bool {
+	return it.source.Next()
+}
+
+func (it *offsetCorrectingTokenIterator) Token() Token {
+	return correctOffset(it.source.Token(), it.correctors)
+}
+
+// 文字列の言語を判定し、言語ごとのAnalyzerで解析するAnalyzerを返す
+// インデックス時はドキュメントごと、検索時はクエリごとに判定する
+// 判定した言語のAnalyzerがなければdefaultLanguageのAnalyzerを使い、それもなければトークンを返さない
+func NewLanguageRoutingAnalyzer(identifier LanguageIdentifier, analyzers map[Language]Analyzer, defaultLanguage Language) Analyzer {
+	return NewAnalyzer([]CharFilter{}, languageRoutingTokenizer{
+		identifier:      identifier,
+		analyzers:       analyzers,
+		defaultLanguage: defaultLanguage,
+	}, []TokenFilter{})
+}
+
+// 言語ごとのAnalyzerをTokenizerとして呼び出す
+// CharFilterとTokenFilterは言語ごとのAnalyzerで適用する
+type languageRoutingTokenizer struct {
+	identifier      LanguageIdentifier
+	analyzers       map[Language]Analyzer
+	defaultLanguage Language
+}
+
+func (t languageRoutingTokenizer) Tokenize(s string) TokenStream {
+	analyzer, _, ok := t.route(s)
+	if !ok {
+		return NewTokenStream([]Token{})
+	}
+	return analyzer.Analyze(s)
+}
+
+func (t languageRoutingTokenizer) TokenizeIterator(s string) TokenIterator {
+	analyzer, _, ok := t.route(s)
+	if !ok {
+		return NewTokenStream([]Token{}).Iterator()
+	}
+	return analyzer.AnalyzeIterator(s)
+}
+
+// 選んだ言語のAnalyzerの各段階の結果を返す
+func (t languageRoutingTokenizer) explain(s string) Analysis {
+	analyzer, language, ok := t.route(s)
+	if !ok {
+		return Analysis{Text: s, Language: language, CharFilters: []CharFilterAnalysis{}, TokenFilters: []TokenStreamAnalysis{}}
+	}
+	explanation := analyzer.Explain(s)
+	explanation.Language = language
+	return explanation
+}
+
+// 文字列の言語と、その言語のAnalyzerを返す
+func (t languageRoutingTokenizer) route(s string) (Analyzer, Language, bool) {
+	language := t.identifier.Identify(s)
+	if analyzer, ok := t.analyzers[language]; ok {
+		return analyzer, language, true
+	}
+	analyzer, ok := t.analyzers[t.defaultLanguage]
+	return analyzer, t.defaultLanguage, ok
+}
+
+// Analyzer.Explainの結果
+type Analysis struct {
+	Text         string                // 解析した文字列
+	Language     Language              // 言語ごとにAnalyzerを選んだ時の言語
+	CharFilters  []CharFilterAnalysis  // 各CharFilterを適用した後の文字列
+	Tokenizer    TokenStreamAnalysis   // トークナイザが分割したトークン
+	TokenFilters []TokenStreamAnalysis // 各TokenFilterを適用した後のトークン
+}
+
+type CharFilterAnalysis struct {
+	Name string
+	Text string
+}
+
+type TokenStreamAnalysis struct {
+	Name   string
+	Tokens []AnalyzedToken
+}
+
+// 位置の増分から求めた位置を付けたトークン
+type AnalyzedToken struct {
+	Token
+	Position uint64
+}
+
+func newTokenStreamAnalysis(name string, tokenStream TokenStream) TokenStreamAnalysis {
+	positions := tokenStream.Positions()
+	tokens := make([]AnalyzedToken, tokenStream.Size())
+	for i, t := range tokenStream.Tokens {
+		tokens[i] = AnalyzedToken{Token: t, Position: positions[i]}
+	}
+	return TokenStreamAnalysis{Name: name, Tokens: tokens}
+}
+
+// ポインタを外した型の名前
+func componentName(component interface{}) string {
+	t := reflect.TypeOf(component)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
+
+// 各段階の結果を1行ずつ並べる
+func (a Analysis) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "text: %q\n", a.Text)
+	if a.Language != "" {
+		fmt.Fprintf(&b, "language: %s\n", a.Language)
+	}
+	for _, c := range a.CharFilters {
+		fmt.Fprintf(&b, "char_filter %s: %q\n", c.Name, c.Text)
+	}
+	writeTokenStreamAnalysis(&b, "tokenizer", a.Tokenizer)
+	for _, f := range a.TokenFilters {
+		writeTokenStreamAnalysis(&b, "filter", f)
+	}
+	return b.String()
+}
+
+func writeTokenStreamAnalysis(b *strings.Builder, stage string, analysis TokenStreamAnalysis) {
+	fmt.Fprintf(b, "%s %s:\n", stage, analysis.Name)
+	for _, t := range analysis.Tokens {
+		fmt.Fprintf(b, "  %d: %q type=%s offset=%d-%d length=%d", t.Position, t.Term, t.Type, t.Start, t.End, positionLength(t.Token))
+		if t.Kana != "" {
+			fmt.Fprintf(b, " kana=%s", t.Kana)
+		}
+		if t.PartOfSpeech != "" {
+			fmt.Fprintf(b, " pos=%s", t.PartOfSpeech)
+		}
+		if t.BaseForm != "" {
+			fmt.Fprintf(b, " base=%s", t.BaseForm)
+		}
+		if t.InflectionType != "" || t.InflectionForm != "" {
+			fmt.Fprintf(b, " inflection=%s/%s", t.InflectionType, t.InflectionForm)
+		}
+		if t.Keyword {
+			b.WriteString(" keyword")
+		}
+		b.WriteString("\n")
+	}
+}
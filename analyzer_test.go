@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
+	"github.com/kotaroooo0/stalefish/morphology"
 )
 
 func TestAnalyze(t *testing.T) {
@@ -22,41 +24,58 @@ func TestAnalyze(t *testing.T) {
 			analyzer: Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}},
 			text:     "a",
 			tokens: NewTokenStream([]Token{
-				NewToken("a"),
+				NewToken("a", setOffset(0, 1), setType(TokenTypeAlphanum)),
 			}),
 		},
 		{
 			analyzer: Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}},
 			text:     "small wild,cat!",
 			tokens: NewTokenStream([]Token{
-				NewToken("small"),
-				NewToken("wild"),
-				NewToken("cat"),
+				NewToken("small", setOffset(0, 5), setType(TokenTypeAlphanum)),
+				NewToken("wild", setOffset(6, 10), setType(TokenTypeAlphanum)),
+				NewToken("cat", setOffset(11, 14), setType(TokenTypeAlphanum)),
 			}),
 		},
 		{
 			analyzer: Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()}},
 			text:     "I am BIG",
 			tokens: NewTokenStream([]Token{
-				NewToken("i"),
-				NewToken("am"),
-				NewToken("big"),
+				NewToken("i", setOffset(0, 1), setType(TokenTypeAlphanum)),
+				NewToken("am", setOffset(2, 4), setType(TokenTypeAlphanum)),
+				NewToken("big", setOffset(5, 8), setType(TokenTypeAlphanum)),
 			}),
 		},
 		{
 			analyzer: Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewStopWordFilter([]string{"a"})}},
 			text:     "how a Big",
 			tokens: NewTokenStream([]Token{
-				NewToken("how"),
-				NewToken("Big"),
+				NewToken("how", setOffset(0, 3), setType(TokenTypeAlphanum)),
+				NewToken("Big", setOffset(6, 9), setType(TokenTypeAlphanum), setPositionIncrement(2)),
+			}),
+		},
+		{
+			analyzer: Analyzer{[]CharFilter{NewNormalizationCharFilter(NFKCCasefold)}, NewStandardTokenizer(), []TokenFilter{}},
+			text:     "ＧＯ ｶﾞｷﾞ",
+			tokens: NewTokenStream([]Token{
+				NewToken("go", setOffset(0, 6), setType(TokenTypeAlphanum)),
+				NewToken("ガギ", setOffset(7, 19), setType(TokenTypeAlphanum)),
+			}),
+		},
+		{
+			analyzer: Analyzer{[]CharFilter{NewHTMLStripCharFilter()}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()}},
+			text:     "<h1>Small</h1><p>wild&nbsp;<em>cat</em></p>",
+			tokens: NewTokenStream([]Token{
+				NewToken("small", setOffset(4, 9), setType(TokenTypeAlphanum)),
+				NewToken("wild", setOffset(17, 21), setType(TokenTypeAlphanum)),
+				NewToken("cat", setOffset(31, 34), setType(TokenTypeAlphanum)),
 			}),
 		},
 		{
 			analyzer: Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewStemmerFilter()}},
 			text:     "Long pens",
 			tokens: NewTokenStream([]Token{
-				NewToken("long"),
-				NewToken("pen"),
+				NewToken("long", setOffset(0, 4), setType(TokenTypeAlphanum)),
+				NewToken("pen", setOffset(5, 9), setType(TokenTypeAlphanum)),
 			}),
 		},
 	}
@@ -69,3 +88,249 @@ func TestAnalyze(t *testing.T) {
 		})
 	}
 }
+
+func TestLanguageRoutingAnalyzer_Analyze(t *testing.T) {
+	cases := []struct {
+		text   string
+		tokens TokenStream
+	}{
+		{
+			text: "東京に行く",
+			tokens: NewTokenStream([]Token{
+				NewToken("東京", setKana("トウキョウ"), setOffset(0, 6), setType(TokenTypeMorpheme)),
+				NewToken("行く", setKana("イク"), setPositionIncrement(2), setOffset(9, 15), setType(TokenTypeMorpheme)),
+			}),
+		},
+		{
+			text: "Running Dogs",
+			tokens: NewTokenStream([]Token{
+				NewToken("run", setOffset(0, 7), setType(TokenTypeAlphanum)),
+				NewToken("dog", setOffset(8, 12), setType(TokenTypeAlphanum)),
+			}),
+		},
+		{
+			text: "2021",
+			tokens: NewTokenStream([]Token{
+				NewToken("2021", setOffset(0, 4), setType(TokenTypeNum)),
+			}),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("text = %v, tokens = %v", tt.text, tt.tokens), func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMorphology := NewMockMorphology(mockCtrl)
+			mockMorphology.EXPECT().Analyze("東京に行く").Return([]morphology.MorphologyToken{
+				morphology.NewMorphologyToken("東京", "トウキョウ"),
+				morphology.NewMorphologyToken("に", "ニ"),
+				morphology.NewMorphologyToken("行く", "イク"),
+			}).AnyTimes()
+
+			analyzer := NewLanguageRoutingAnalyzer(NewScriptLanguageIdentifier(), map[Language]Analyzer{
+				Japanese: NewAnalyzer([]CharFilter{}, NewMorphologicalTokenizer(mockMorphology), []TokenFilter{NewStopWordFilter([]string{"に"})}),
+				English:  NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewStemmerFilter()}),
+			}, English)
+
+			if diff := cmp.Diff(analyzer.Analyze(tt.text), tt.tokens); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAnalyzer_Explain(t *testing.T) {
+	analyzer := NewAnalyzer(
+		[]CharFilter{NewHTMLStripCharFilter(), NewMappingCharFilter(map[string]string{":(": "sad"})},
+		NewStandardTokenizer(),
+		[]TokenFilter{NewLowercaseFilter(), NewStopWordFilter([]string{"i"}), NewStemmerFilter()},
+	)
+	expected := Analysis{
+		Text: "<b>I</b> feel TIRED :(",
+		CharFilters: []CharFilterAnalysis{
+			{Name: "HTMLStripCharFilter", Text: "I feel TIRED :("},
+			{Name: "MappingCharFilter", Text: "I feel TIRED sad"},
+		},
+		Tokenizer: TokenStreamAnalysis{Name: "StandardTokenizer", Tokens: []AnalyzedToken{
+			{Token: NewToken("I", setOffset(3, 4), setType(TokenTypeAlphanum)), Position: 0},
+			{Token: NewToken("feel", setOffset(9, 13), setType(TokenTypeAlphanum)), Position: 1},
+			{Token: NewToken("TIRED", setOffset(14, 19), setType(TokenTypeAlphanum)), Position: 2},
+			{Token: NewToken("sad", setOffset(20, 22), setType(TokenTypeAlphanum)), Position: 3},
+		}},
+		TokenFilters: []TokenStreamAnalysis{
+			{Name: "LowercaseFilter", Tokens: []AnalyzedToken{
+				{Token: NewToken("i", setOffset(3, 4), setType(TokenTypeAlphanum)), Position: 0},
+				{Token: NewToken("feel", setOffset(9, 13), setType(TokenTypeAlphanum)), Position: 1},
+				{Token: NewToken("tired", setOffset(14, 19), setType(TokenTypeAlphanum)), Position: 2},
+				{Token: NewToken("sad", setOffset(20, 22), setType(TokenTypeAlphanum)), Position: 3},
+			}},
+			{Name: "StopWordFilter", Tokens: []AnalyzedToken{
+				{Token: NewToken("feel", setOffset(9, 13), setType(TokenTypeAlphanum), setPositionIncrement(2)), Position: 1},
+				{Token: NewToken("tired", setOffset(14, 19), setType(TokenTypeAlphanum)), Position: 2},
+				{Token: NewToken("sad", setOffset(20, 22), setType(TokenTypeAlphanum)), Position: 3},
+			}},
+			{Name: "StemmerFilter", Tokens: []AnalyzedToken{
+				{Token: NewToken("feel", setOffset(9, 13), setType(TokenTypeAlphanum), setPositionIncrement(2)), Position: 1},
+				{Token: NewToken("tire", setOffset(14, 19), setType(TokenTypeAlphanum)), Position: 2},
+				{Token: NewToken("sad", setOffset(20, 22), setType(TokenTypeAlphanum)), Position: 3},
+			}},
+		},
+	}
+
+	actual := analyzer.Explain(expected.Text)
+
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	// 最後の段階のトークンはAnalyzeの結果と同じ
+	if diff := cmp.Diff(analyzer.Analyze(expected.Text).Terms(), []string{"feel", "tire", "sad"}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestAnalysis_String(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMorphology := NewMockMorphology(mockCtrl)
+	mockMorphology.EXPECT().Analyze("走った").Return([]morphology.MorphologyToken{
+		morphology.NewMorphologyToken("走っ", "ハシッ", morphology.WithPartOfSpeech("動詞-自立"), morphology.WithBaseForm("走る"), morphology.WithInflection("五段・ラ行", "連用タ接続")),
+		morphology.NewMorphologyToken("た", "タ", morphology.WithPartOfSpeech("助動詞"), morphology.WithBaseForm("た")),
+	})
+	analyzer := NewLanguageRoutingAnalyzer(NewScriptLanguageIdentifier(), map[Language]Analyzer{
+		Japanese: NewAnalyzer([]CharFilter{}, NewMorphologicalTokenizer(mockMorphology), []TokenFilter{NewJapanesePOSStopFilter(DefaultJapanesePOSStopTags)}),
+	}, English)
+	expected := `text: "走った"
+language: japanese
+tokenizer MorphologicalTokenizer:
+  0: "走っ" type=<MORPHEME> offset=0-6 length=1 kana=ハシッ pos=動詞-自立 base=走る inflection=五段・ラ行/連用タ接続
+  1: "た" type=<MORPHEME> offset=6-9 length=1 kana=タ pos=助動詞 base=た
+filter JapanesePOSStopFilter:
+  0: "走っ" type=<MORPHEME> offset=0-6 length=1 kana=ハシッ pos=動詞-自立 base=走る inflection=五段・ラ行/連用タ接続
+`
+
+	actual := analyzer.Explain("走った").String()
+
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestAnalyzer_AnalyzeIterator(t *testing.T) {
+	synonyms := NewSynonymMap()
+	synonyms.AddEquivalent([]string{"ny", "new york"}, true)
+	cases := []struct {
+		analyzer Analyzer
+		text     string
+	}{
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}),
+			text:     "",
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewStopWordFilter([]string{"a", "the"}), NewStemmerFilter()}),
+			text:     "The Quick foxes, a 2021 JUMPING dog!",
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{NewHTMLStripCharFilter(), NewNormalizationCharFilter(NFKCCasefold)}, NewStandardTokenizer(), []TokenFilter{NewLengthFilter(2, 0)}),
+			text:     "<p>Ａ ｶﾞｷﾞ&amp;go</p>",
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewSynonymFilter(synonyms), NewLengthFilter(3, 0)}),
+			text:     "I love NY city",
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewNgramTokenizer(2), []TokenFilter{NewLowercaseFilter()}),
+			text:     "白馬Go",
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewNgramTokenizer(3), []TokenFilter{}),
+			text:     "ab",
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewCJKBigramTokenizer(), []TokenFilter{NewKeywordMarkerFilter([]string{"running"}), NewStemmerFilter()}),
+			text:     "東京で running jumps",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("text = %v", tt.text), func(t *testing.T) {
+			if diff := cmp.Diff(CollectTokens(tt.analyzer.AnalyzeIterator(tt.text)), tt.analyzer.Analyze(tt.text)); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+// StreamingTokenFilterは、後段が読んだ分だけ前段からトークンを読む
+func TestStreamingTokenFilter_FilterIterator(t *testing.T) {
+	source := &countingTokenIterator{source: NewStandardTokenizer().TokenizeIterator("The quick brown fox jumps over the lazy dog")}
+	var it TokenIterator = source
+	for _, f := range []TokenFilter{NewLowercaseFilter(), NewStopWordFilter([]string{"the"}), NewStemmerFilter()} {
+		it = filterIterator(f, it)
+	}
+
+	terms := make([]string, 0)
+	for len(terms) < 2 && it.Next() {
+		terms = append(terms, it.Token().Term)
+	}
+	if diff := cmp.Diff(terms, []string{"quick", "brown"}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if source.count != 3 {
+		t.Errorf("source.count = %v, want %v", source.count, 3)
+	}
+}
+
+// 先読みするTokenFilterも、必要な数だけ前段からトークンを読む
+func TestStreamingTokenFilter_Lookahead(t *testing.T) {
+	synonyms := NewSynonymMap()
+	synonyms.AddOneWay([]string{"quick brown fox"}, []string{"fast fox"})
+	cases := []struct {
+		filter   TokenFilter
+		read     int
+		expected []string
+		count    int
+	}{
+		{filter: NewShingleFilter(2, 3, " ", true), read: 2, expected: []string{"The", "The quick"}, count: 3},
+		{filter: NewSynonymFilter(synonyms), read: 1, expected: []string{"The"}, count: 3},
+		{filter: NewSynonymFilter(synonyms), read: 2, expected: []string{"The", "fast"}, count: 4},
+		{filter: NewUniqueFilter(false), read: 2, expected: []string{"The", "quick"}, count: 2},
+		{filter: NewEdgeNgramFilter(1, 2, EdgeNgramFront), read: 2, expected: []string{"T", "Th"}, count: 1},
+		{filter: NewWordDelimiterFilter(), read: 1, expected: []string{"The"}, count: 1},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("filter = %T, read = %v", tt.filter, tt.read), func(t *testing.T) {
+			source := &countingTokenIterator{source: NewStandardTokenizer().TokenizeIterator("The quick brown fox jumps over the lazy dog")}
+			it := filterIterator(tt.filter, source)
+			terms := make([]string, 0)
+			for len(terms) < tt.read && it.Next() {
+				terms = append(terms, it.Token().Term)
+			}
+			if diff := cmp.Diff(terms, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+			if source.count != tt.count {
+				t.Errorf("source.count = %v, want %v", source.count, tt.count)
+			}
+		})
+	}
+}
+
+// 読み出したトークンの数を数えるイテレータ
+type countingTokenIterator struct {
+	source TokenIterator
+	count  int
+}
+
+func (it *countingTokenIterator) Next() bool {
+	if !it.source.Next() {
+		return false
+	}
+	it.count++
+	return true
+}
+
+func (it *countingTokenIterator) Token() Token {
+	return it.source.Token()
+}
@@ -1,22 +1,521 @@
 package stalefish
 
-import "strings"
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
 
 type CharFilter interface {
 	Filter(string) string
 }
 
+// 変換後の文字列中の位置から変換前の文字列中の位置を求められるCharFilter
+// Analyzerはこれを使ってトークンのオフセットを元の文字列中の位置に補正する
+type OffsetCorrectingCharFilter interface {
+	CharFilter
+	FilterWithOffsets(string) (string, OffsetCorrector)
+}
+
+// 変換後の文字列中の位置(バイト)を変換前の文字列中の位置(バイト)に補正する
+// 変換後の文字列を、変換前の文字列をそのまま写した区間と置き換えた区間に分けて記録する
+// 置き換えた区間の中では文字の対応が分からないので、位置を区間の端に補正し、文字の途中を指さないようにする
+type OffsetCorrector struct {
+	points []offsetPoint // filteredの昇順
+}
+
+// 変換後の位置filteredが変換前の位置originalに対応し、次の点までの区間がreplacedなら置き換えた区間であることを表す
+type offsetPoint struct {
+	filtered int
+	original int
+	replaced bool
+}
+
+// 変換後の文字列のfiltered以降は、変換前の文字列のoriginal以降をそのまま写したものであることを記録する
+// filteredの昇順に追加する。同じfilteredで続けて追加した場合は、その間の変換前の文字列が取り除かれたことを表す
+func (c *OffsetCorrector) add(filtered, original int) {
+	c.addPoint(offsetPoint{filtered: filtered, original: original})
+}
+
+// 変換後の文字列のfiltered以降は、変換前の文字列のoriginal以降を置き換えたものであることを記録する
+// 置き換えた区間の終わりはaddで記録する
+func (c *OffsetCorrector) addReplaced(filtered, original int) {
+	c.addPoint(offsetPoint{filtered: filtered, original: original, replaced: true})
+}
+
+func (c *OffsetCorrector) addPoint(p offsetPoint) {
+	// 同じ位置の点は後から追加した区間の種類で上書きする
+	if n := len(c.points); n > 0 && c.points[n-1].filtered == p.filtered && c.points[n-1].original == p.original {
+		c.points[n-1] = p
+		return
+	}
+	c.points = append(c.points, p)
+}
+
+// トークンの開始位置を補正する
+// 取り除かれた部分の直後の位置は取り除かれた部分の後ろに、置き換えた区間の途中の位置は置き換えられる前の部分の始まりに補正する
+func (c OffsetCorrector) Correct(offset int) int {
+	// offset以下で最大のfilteredを持つ点の区間に含まれる
+	i := sort.Search(len(c.points), func(i int) bool { return c.points[i].filtered > offset }) - 1
+	if i < 0 {
+		return offset
+	}
+	if c.points[i].replaced {
+		return c.points[i].original
+	}
+	return c.points[i].original + offset - c.points[i].filtered
+}
+
+// トークンの終了位置を補正する
+// 取り除かれた部分の直前の位置は取り除かれた部分の前に、置き換えた区間の途中と終わりの位置は置き換えられる前の部分の終わりに補正する
+func (c OffsetCorrector) CorrectEnd(offset int) int {
+	// offset未満で最大のfilteredを持つ点の区間に含まれる
+	i := sort.Search(len(c.points), func(i int) bool { return c.points[i].filtered >= offset }) - 1
+	if i < 0 {
+		return c.Correct(offset)
+	}
+	if c.points[i].replaced && i+1 < len(c.points) {
+		return c.points[i+1].original
+	}
+	return c.points[i].original + offset - c.points[i].filtered
+}
+
 type MappingCharFilter struct {
 	mapper map[string]string // key->valueにマッピングする
+	keys   map[byte][]string // 先頭のバイトごとのkey。長い順、同じ長さなら辞書順に並べる
 }
 
 func NewMappingCharFilter(mapper map[string]string) MappingCharFilter {
-	return MappingCharFilter{mapper: mapper}
+	return MappingCharFilter{mapper: mapper, keys: mappingKeys(mapper)}
+}
+
+// 長い順、同じ長さなら辞書順に試すことで結果を一意にする
+func mappingKeys(mapper map[string]string) map[byte][]string {
+	keys := make(map[byte][]string)
+	for k := range mapper {
+		if k != "" {
+			keys[k[0]] = append(keys[k[0]], k)
+		}
+	}
+	for _, ks := range keys {
+		sort.Slice(ks, func(i, j int) bool {
+			if len(ks[i]) != len(ks[j]) {
+				return len(ks[i]) > len(ks[j])
+			}
+			return ks[i] < ks[j]
+		})
+	}
+	return keys
 }
 
 func (c MappingCharFilter) Filter(s string) string {
-	for k, v := range c.mapper {
-		s = strings.Replace(s, k, v, -1)
+	filtered, _ := c.FilterWithOffsets(s)
+	return filtered
+}
+
+// 先頭から順に、その位置から始まる最も長いkeyを置き換える
+// 置き換えた結果は再び置き換えない
+// 各位置では、その位置のバイトから始まるkeyだけを試す
+func (c MappingCharFilter) FilterWithOffsets(s string) (string, OffsetCorrector) {
+	keys := c.keys
+	if keys == nil {
+		keys = mappingKeys(c.mapper)
+	}
+
+	var b strings.Builder
+	var corrector OffsetCorrector
+	for i := 0; i < len(s); {
+		matched := ""
+		for _, k := range keys[s[i]] {
+			if strings.HasPrefix(s[i:], k) {
+				matched = k
+				break
+			}
+		}
+		if matched == "" {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		corrector.addReplaced(b.Len(), i)
+		b.WriteString(c.mapper[matched])
+		i += len(matched)
+		corrector.add(b.Len(), i)
+	}
+	return b.String(), corrector
+}
+
+// 正規表現にマッチした部分を置き換えるCharFilter
+// replacementでは$1や${name}でキャプチャしたグループを参照できる
+type PatternReplaceCharFilter struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func NewPatternReplaceCharFilter(pattern *regexp.Regexp, replacement string) PatternReplaceCharFilter {
+	return PatternReplaceCharFilter{
+		pattern:     pattern,
+		replacement: replacement,
+	}
+}
+
+func (c PatternReplaceCharFilter) Filter(s string) string {
+	filtered, _ := c.FilterWithOffsets(s)
+	return filtered
+}
+
+func (c PatternReplaceCharFilter) FilterWithOffsets(s string) (string, OffsetCorrector) {
+	var b strings.Builder
+	var corrector OffsetCorrector
+	prev := 0
+	for _, m := range c.pattern.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(s[prev:m[0]])
+		corrector.addReplaced(b.Len(), m[0])
+		b.Write(c.pattern.ExpandString(nil, c.replacement, s, m))
+		corrector.add(b.Len(), m[1])
+		prev = m[1]
+	}
+	b.WriteString(s[prev:])
+	return b.String(), corrector
+}
+
+// Unicode正規化の形式
+type NormalizationForm int
+
+const (
+	NFC NormalizationForm = iota + 1
+	NFKC
+	NFKCCasefold // NFKCに加えて大文字小文字を畳み込む
+)
+
+// Unicode正規化を行うCharFilter
+// 全角英数字と半角英数字、半角カタカナと全角カタカナ等を同一視できるようにする
+type NormalizationCharFilter struct {
+	form NormalizationForm
+}
+
+func NewNormalizationCharFilter(form NormalizationForm) NormalizationCharFilter {
+	return NormalizationCharFilter{form: form}
+}
+
+func (c NormalizationCharFilter) Filter(s string) string {
+	filtered, _ := c.FilterWithOffsets(s)
+	return filtered
+}
+
+// 正規化の境界ごとに区切って正規化し、区切りの位置の対応を記録する
+func (c NormalizationCharFilter) FilterWithOffsets(s string) (string, OffsetCorrector) {
+	var b strings.Builder
+	var corrector OffsetCorrector
+	for i := 0; i < len(s); {
+		n := c.boundaryForm().NextBoundaryInString(s[i:], true)
+		if n <= 0 {
+			n = len(s) - i
+		}
+		segment, normalized := s[i:i+n], c.normalize(s[i:i+n])
+		if normalized == segment {
+			corrector.add(b.Len(), i)
+		} else {
+			corrector.addReplaced(b.Len(), i)
+		}
+		b.WriteString(normalized)
+		i += n
+	}
+	corrector.add(b.Len(), len(s))
+	return b.String(), corrector
+}
+
+// 互換分解では半角の濁点等が結合文字になるので、境界も正規化の形式に合わせて求める
+func (c NormalizationCharFilter) boundaryForm() norm.Form {
+	if c.form == NFC {
+		return norm.NFC
+	}
+	return norm.NFKC
+}
+
+func (c NormalizationCharFilter) normalize(s string) string {
+	switch c.form {
+	case NFC:
+		return norm.NFC.String(s)
+	case NFKC:
+		return norm.NFKC.String(s)
+	case NFKCCasefold:
+		return norm.NFKC.String(cases.Fold().String(norm.NFKC.String(s)))
 	}
 	return s
 }
+
+// HTMLのタグ、コメント、script・styleの中身を取り除き、文字参照をデコードするCharFilter
+// ブロック要素のタグは空白に置き換え、前後の語句が繋がらないようにする
+// 取り除いた部分と隣接する位置は、取り除いた部分の後ろの位置に補正される
+type HTMLStripCharFilter struct{}
+
+func NewHTMLStripCharFilter() HTMLStripCharFilter {
+	return HTMLStripCharFilter{}
+}
+
+// 空白に置き換えるタグ
+var htmlBlockTags = map[string]struct{}{
+	"address": {}, "article": {}, "aside": {}, "blockquote": {}, "br": {}, "dd": {}, "div": {}, "dl": {}, "dt": {},
+	"fieldset": {}, "figcaption": {}, "figure": {}, "footer": {}, "form": {}, "h1": {}, "h2": {}, "h3": {}, "h4": {},
+	"h5": {}, "h6": {}, "header": {}, "hr": {}, "li": {}, "main": {}, "nav": {}, "ol": {}, "p": {}, "pre": {},
+	"section": {}, "table": {}, "tbody": {}, "td": {}, "tfoot": {}, "th": {}, "thead": {}, "title": {}, "tr": {}, "ul": {},
+}
+
+// 中身ごと取り除くタグ
+var htmlSkipContentTags = map[string]struct{}{
+	"script": {}, "style": {},
+}
+
+func (c HTMLStripCharFilter) Filter(s string) string {
+	filtered, _ := c.FilterWithOffsets(s)
+	return filtered
+}
+
+func (c HTMLStripCharFilter) FilterWithOffsets(s string) (string, OffsetCorrector) {
+	var b strings.Builder
+	var corrector OffsetCorrector
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			end, name, closing := scanHTMLTag(s, i)
+			if end < 0 {
+				break
+			}
+			if _, ok := htmlSkipContentTags[name]; ok && !closing {
+				end = skipHTMLContent(s, end, name)
+			}
+			corrector.addReplaced(b.Len(), i)
+			_, block := htmlBlockTags[name]
+			_, skipContent := htmlSkipContentTags[name]
+			if block || skipContent {
+				b.WriteByte(' ')
+			}
+			corrector.add(b.Len(), end)
+			i = end
+			continue
+		case '&':
+			end, decoded := scanHTMLEntity(s, i)
+			if end < 0 {
+				break
+			}
+			corrector.addReplaced(b.Len(), i)
+			b.WriteString(decoded)
+			corrector.add(b.Len(), end)
+			i = end
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	corrector.add(b.Len(), len(s))
+	return b.String(), corrector
+}
+
+// s[i]の'<'から始まるタグ、コメント等の終わりの位置と、小文字にしたタグ名を返す
+// タグとして解釈できなければ終わりの位置として-1を返す
+func scanHTMLTag(s string, i int) (end int, name string, closing bool) {
+	rest := s[i:]
+	switch {
+	case strings.HasPrefix(rest, "<!--"):
+		if j := strings.Index(rest[4:], "-->"); j >= 0 {
+			return i + 4 + j + 3, "", false
+		}
+		return len(s), "", false
+	case strings.HasPrefix(rest, "<!"), strings.HasPrefix(rest, "<?"):
+		if j := strings.IndexByte(rest, '>'); j >= 0 {
+			return i + j + 1, "", false
+		}
+		return -1, "", false
+	}
+
+	j := 1
+	if j < len(rest) && rest[j] == '/' {
+		closing = true
+		j++
+	}
+	start := j
+	for j < len(rest) && isHTMLNameChar(rest[j]) {
+		j++
+	}
+	if j == start || !isASCIILetter(rest[start]) {
+		return -1, "", false
+	}
+	name = strings.ToLower(rest[start:j])
+	// 属性値の中の'>'はタグの終わりとみなさない
+	var quote byte
+	for ; j < len(rest); j++ {
+		switch {
+		case quote != 0:
+			if rest[j] == quote {
+				quote = 0
+			}
+		case rest[j] == '"' || rest[j] == '\'':
+			quote = rest[j]
+		case rest[j] == '>':
+			// <script />のように自己終了しているタグは中身を持たない
+			if rest[j-1] == '/' {
+				closing = true
+			}
+			return i + j + 1, name, closing
+		}
+	}
+	return -1, "", false
+}
+
+// script・styleの中身を読み飛ばし、閉じタグの終わりの位置を返す
+func skipHTMLContent(s string, i int, name string) int {
+	lower := strings.ToLower(s[i:])
+	j := strings.Index(lower, "</"+name)
+	if j < 0 {
+		return len(s)
+	}
+	if k := strings.IndexByte(lower[j:], '>'); k >= 0 {
+		return i + j + k + 1
+	}
+	return len(s)
+}
+
+// s[i]の'&'から始まる文字参照の終わりの位置とデコードした文字列を返す
+// 文字参照として解釈できなければ終わりの位置として-1を返す
+func scanHTMLEntity(s string, i int) (int, string) {
+	j := i + 1
+	for j < len(s) && j-i <= htmlMaxEntityLength && (isHTMLNameChar(s[j]) || s[j] == '#') {
+		j++
+	}
+	if j < len(s) && s[j] == ';' {
+		j++
+	}
+	if j == i+1 {
+		return -1, ""
+	}
+	decoded := html.UnescapeString(s[i:j])
+	if decoded == s[i:j] {
+		return -1, ""
+	}
+	return j, decoded
+}
+
+// 最も長い名前付き文字参照(&CounterClockwiseContourIntegral;)程度の長さまで読む
+const htmlMaxEntityLength = 32
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isHTMLNameChar(c byte) bool {
+	return isASCIILetter(c) || '0' <= c && c <= '9' || c == '-' || c == ':'
+}
+
+// 踊り字(々、ゝ、ゞ、ヽ、ヾ)を直前の文字に置き換えるCharFilter(時々→時時、いすゞ→いすず)
+// 踊り字がn個続く時は直前のn文字を繰り返す。繰り返す文字の種類が踊り字と合わなければ変換しない
+type JapaneseIterationMarkCharFilter struct{}
+
+func NewJapaneseIterationMarkCharFilter() JapaneseIterationMarkCharFilter {
+	return JapaneseIterationMarkCharFilter{}
+}
+
+const (
+	kanjiIterationMark          = '々'
+	hiraganaIterationMark       = 'ゝ'
+	hiraganaVoicedIterationMark = 'ゞ'
+	katakanaIterationMark       = 'ヽ'
+	katakanaVoicedIterationMark = 'ヾ'
+)
+
+func isIterationMark(r rune) bool {
+	switch r {
+	case kanjiIterationMark, hiraganaIterationMark, hiraganaVoicedIterationMark, katakanaIterationMark, katakanaVoicedIterationMark:
+		return true
+	}
+	return false
+}
+
+func (c JapaneseIterationMarkCharFilter) Filter(s string) string {
+	filtered, _ := c.FilterWithOffsets(s)
+	return filtered
+}
+
+func (c JapaneseIterationMarkCharFilter) FilterWithOffsets(s string) (string, OffsetCorrector) {
+	runes := []rune(s)
+	var b strings.Builder
+	var corrector OffsetCorrector
+	offset := 0 // runes[i]の元の文字列中の位置(バイト)
+	for i := 0; i < len(runes); {
+		if !isIterationMark(runes[i]) {
+			b.WriteRune(runes[i])
+			offset += utf8.RuneLen(runes[i])
+			i++
+			continue
+		}
+		// 続く踊り字の数だけ前の文字を繰り返す
+		n := 0
+		for i+n < len(runes) && isIterationMark(runes[i+n]) {
+			n++
+		}
+		for j := 0; j < n; j++ {
+			mark := runes[i+j]
+			r := mark
+			if i-n+j >= 0 {
+				r = iterate(mark, runes[i-n+j])
+			}
+			corrector.addReplaced(b.Len(), offset)
+			b.WriteRune(r)
+			offset += utf8.RuneLen(mark)
+			corrector.add(b.Len(), offset)
+		}
+		i += n
+	}
+	return b.String(), corrector
+}
+
+// 踊り字markが繰り返す文字sourceを返す
+// 濁点付きの踊り字は濁音に、濁点なしの踊り字は清音にする
+func iterate(mark, source rune) rune {
+	switch mark {
+	case kanjiIterationMark:
+		if unicode.Is(unicode.Han, source) {
+			return source
+		}
+	case hiraganaIterationMark, katakanaIterationMark:
+		if isKanaFor(mark, source) {
+			return unvoiced(source)
+		}
+	case hiraganaVoicedIterationMark, katakanaVoicedIterationMark:
+		if isKanaFor(mark, source) {
+			return voiced(source)
+		}
+	}
+	return mark
+}
+
+func isKanaFor(mark, source rune) bool {
+	if mark == hiraganaIterationMark || mark == hiraganaVoicedIterationMark {
+		return unicode.Is(unicode.Hiragana, source)
+	}
+	return unicode.Is(unicode.Katakana, source)
+}
+
+// 濁点・半濁点を取り除く(が→か)
+func unvoiced(r rune) rune {
+	decomposed := []rune(norm.NFD.String(string(r)))
+	if len(decomposed) == 2 && (decomposed[1] == '\u3099' || decomposed[1] == '\u309a') {
+		return decomposed[0]
+	}
+	return r
+}
+
+// 濁点を付ける(か→が)。濁音がない文字はそのまま返す
+func voiced(r rune) rune {
+	composed := []rune(norm.NFC.String(string(unvoiced(r)) + "\u3099"))
+	if len(composed) == 1 {
+		return composed[0]
+	}
+	return r
+}
@@ -2,7 +2,9 @@ package stalefish
 
 import (
 	"fmt"
+	"regexp"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestMappingCharFilter_Filter(t *testing.T) {
@@ -16,15 +18,261 @@ func TestMappingCharFilter_Filter(t *testing.T) {
 			s:      "かきくけこ",
 			want:   "kakiくけこ",
 		},
+		{
+			// 重なるkeyは長い方を優先する
+			mapper: map[string]string{"a": "1", "ab": "2", "abc": "3", "bc": "4"},
+			s:      "abcabab",
+			want:   "322",
+		},
+		{
+			// 置き換えた結果は再び置き換えない
+			mapper: map[string]string{"a": "b", "b": "c"},
+			s:      "ab",
+			want:   "bc",
+		},
+		{
+			// 先頭のバイトが同じkeyは最も長いものを選ぶ
+			mapper: map[string]string{"a": "Y", "ab": "X", "abc": "Z"},
+			s:      "abcab a",
+			want:   "ZX Y",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("mapper = %v, s = %v, want = %v", tt.mapper, tt.s, tt.want), func(t *testing.T) {
-			c := MappingCharFilter{
-				mapper: tt.mapper,
-			}
+			c := NewMappingCharFilter(tt.mapper)
 			if got := c.Filter(tt.s); got != tt.want {
 				t.Errorf("MappingCharFilter.Filter() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestNormalizationCharFilter_Filter(t *testing.T) {
+	tests := []struct {
+		form NormalizationForm
+		s    string
+		want string
+	}{
+		{form: NFC, s: "が", want: "が"},
+		{form: NFC, s: "ＧＯ", want: "ＧＯ"},
+		{form: NFKC, s: "ｶﾞｷﾞ ＧＯ", want: "ガギ GO"},
+		{form: NFKC, s: "㍿ABC", want: "株式会社ABC"},
+		{form: NFKCCasefold, s: "ｶﾞｷﾞ ＧＯ", want: "ガギ go"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("form = %v, s = %v, want = %v", tt.form, tt.s, tt.want), func(t *testing.T) {
+			c := NewNormalizationCharFilter(tt.form)
+			if got := c.Filter(tt.s); got != tt.want {
+				t.Errorf("NormalizationCharFilter.Filter() = %v, want %v", got, tt.want)
+			}
+			got, _ := c.FilterWithOffsets(tt.s)
+			if got != tt.want {
+				t.Errorf("NormalizationCharFilter.FilterWithOffsets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizationCharFilter_FilterWithOffsets(t *testing.T) {
+	// "ＧＯ"は1文字3バイト、"GO"は1文字1バイト
+	s := "ＧＯ ＧＯ"
+	got, corrector := NewNormalizationCharFilter(NFKC).FilterWithOffsets(s)
+	if got != "GO GO" {
+		t.Fatalf("NormalizationCharFilter.FilterWithOffsets() = %v, want %v", got, "GO GO")
+	}
+	tests := []struct {
+		offset int
+		want   int
+	}{
+		{offset: 0, want: 0},
+		{offset: 1, want: 3},
+		{offset: 2, want: 6},
+		{offset: 3, want: 7},
+		{offset: 5, want: 13},
+	}
+	for _, tt := range tests {
+		if got := corrector.Correct(tt.offset); got != tt.want {
+			t.Errorf("OffsetCorrector.Correct(%d) = %v, want %v", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizationCharFilter_FilterWithOffsets_Expanding(t *testing.T) {
+	// "㈱"は"(株)"に、"ﬁ"は"fi"に展開される
+	s := "㈱白馬 ﬁsh"
+	got, corrector := NewNormalizationCharFilter(NFKCCasefold).FilterWithOffsets(s)
+	if got != "(株)白馬 fish" {
+		t.Fatalf("NormalizationCharFilter.FilterWithOffsets() = %v, want %v", got, "(株)白馬 fish")
+	}
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		// 展開された文字の途中を指すトークンは、展開される前の文字全体に補正する
+		{start: 1, end: 4, want: "㈱"},
+		{start: 1, end: 11, want: "㈱白馬"},
+		{start: 12, end: 13, want: "ﬁ"},
+		{start: 13, end: 16, want: "ﬁsh"},
+	}
+	for _, tt := range tests {
+		start, end := corrector.Correct(tt.start), corrector.CorrectEnd(tt.end)
+		if !utf8.ValidString(s[start:end]) || s[start:end] != tt.want {
+			t.Errorf("original of [%d:%d] = %q, want %q", tt.start, tt.end, s[start:end], tt.want)
+		}
+	}
+}
+
+func TestMappingCharFilter_FilterWithOffsets(t *testing.T) {
+	s := "①番 ㌔"
+	got, corrector := NewMappingCharFilter(map[string]string{"①": "1", "㌔": "キロ"}).FilterWithOffsets(s)
+	if got != "1番 キロ" {
+		t.Fatalf("MappingCharFilter.FilterWithOffsets() = %v, want %v", got, "1番 キロ")
+	}
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{start: 0, end: 4, want: "①番"},
+		{start: 5, end: 8, want: "㌔"},
+		{start: 8, end: 11, want: "㌔"},
+	}
+	for _, tt := range tests {
+		start, end := corrector.Correct(tt.start), corrector.CorrectEnd(tt.end)
+		if s[start:end] != tt.want {
+			t.Errorf("original of [%d:%d] = %q, want %q", tt.start, tt.end, s[start:end], tt.want)
+		}
+	}
+}
+
+func TestHTMLStripCharFilter_Filter(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "plain text", want: "plain text"},
+		{s: "<b>bold</b>er", want: "bolder"},
+		{s: "<p>one</p><p>two</p>", want: " one  two "},
+		{s: "a<br/>b", want: "a b"},
+		{s: "caf&eacute; &amp; &#x41;&#66; &unknown;", want: "café & AB &unknown;"},
+		{s: `<script type="text/javascript">var s = "<p>";</script>text<STYLE>p {}</STYLE>`, want: " text "},
+		{s: "<!-- comment -->a<!DOCTYPE html>b", want: "ab"},
+		{s: `<a href="x>y" title='z'>link</a>`, want: "link"},
+		{s: "5 < 6 && 7 > 6", want: "5 < 6 && 7 > 6"},
+		{s: "broken <div", want: "broken <div"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("s = %v, want = %v", tt.s, tt.want), func(t *testing.T) {
+			c := NewHTMLStripCharFilter()
+			if got := c.Filter(tt.s); got != tt.want {
+				t.Errorf("HTMLStripCharFilter.Filter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLStripCharFilter_FilterWithOffsets(t *testing.T) {
+	s := "<p>caf&eacute; <b>wild</b> cat</p>"
+	got, corrector := NewHTMLStripCharFilter().FilterWithOffsets(s)
+	if got != " café wild cat " {
+		t.Fatalf("HTMLStripCharFilter.FilterWithOffsets() = %q, want %q", got, " café wild cat ")
+	}
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{start: 1, end: 6, want: "caf&eacute;"},
+		{start: 7, end: 11, want: "wild"},
+		{start: 12, end: 15, want: "cat"},
+	}
+	for _, tt := range tests {
+		start, end := corrector.Correct(tt.start), corrector.CorrectEnd(tt.end)
+		if s[start:end] != tt.want {
+			t.Errorf("original of [%d:%d] = %q, want %q", tt.start, tt.end, s[start:end], tt.want)
+		}
+	}
+}
+
+func TestMappingCharFilter_Deterministic(t *testing.T) {
+	c := NewMappingCharFilter(map[string]string{"ab": "x", "bc": "y", "b": "z", "a": "w"})
+	for i := 0; i < 100; i++ {
+		if got := c.Filter("abcbc"); got != "xcy" {
+			t.Fatalf("MappingCharFilter.Filter() = %v, want %v", got, "xcy")
+		}
+	}
+}
+
+func TestPatternReplaceCharFilter_Filter(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		replacement string
+		s           string
+		want        string
+	}{
+		{pattern: `\s+`, replacement: " ", s: "a  b\t\nc", want: "a b c"},
+		{pattern: `(\d+)-(\d+)`, replacement: "$2$1", s: "tel 03-1234", want: "tel 123403"},
+		{pattern: `(?P<user>\w+)@example\.com`, replacement: "${user}", s: "mail alice@example.com", want: "mail alice"},
+		{pattern: `x`, replacement: "y", s: "abc", want: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("pattern = %v, replacement = %v, s = %v, want = %v", tt.pattern, tt.replacement, tt.s, tt.want), func(t *testing.T) {
+			c := NewPatternReplaceCharFilter(regexp.MustCompile(tt.pattern), tt.replacement)
+			if got := c.Filter(tt.s); got != tt.want {
+				t.Errorf("PatternReplaceCharFilter.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternReplaceCharFilter_FilterWithOffsets(t *testing.T) {
+	s := "foo-bar baz"
+	got, corrector := NewPatternReplaceCharFilter(regexp.MustCompile(`-`), "").FilterWithOffsets(s)
+	if got != "foobar baz" {
+		t.Fatalf("PatternReplaceCharFilter.FilterWithOffsets() = %v, want %v", got, "foobar baz")
+	}
+	// "foobar"は元の文字列の"foo-bar"、"baz"は"baz"に対応する
+	if start, end := corrector.Correct(0), corrector.CorrectEnd(6); s[start:end] != "foo-bar" {
+		t.Errorf("original of [0:6] = %q, want %q", s[start:end], "foo-bar")
+	}
+	if start, end := corrector.Correct(7), corrector.CorrectEnd(10); s[start:end] != "baz" {
+		t.Errorf("original of [7:10] = %q, want %q", s[start:end], "baz")
+	}
+}
+
+func TestJapaneseIterationMarkCharFilter_Filter(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: "時々", want: "時時"},
+		{s: "こゝろ", want: "こころ"},
+		{s: "いすゞ", want: "いすず"},
+		{s: "がゝ", want: "がか"},
+		{s: "バナヽ", want: "バナナ"},
+		{s: "ハヾ", want: "ハバ"},
+		{s: "部分々々", want: "部分部分"},
+		{s: "々", want: "々"},
+		{s: "あ々", want: "あ々"},
+		{s: "漢ゝ", want: "漢ゝ"},
+		{s: "んゞ", want: "んん"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("s = %v, want = %v", tt.s, tt.want), func(t *testing.T) {
+			c := NewJapaneseIterationMarkCharFilter()
+			if got := c.Filter(tt.s); got != tt.want {
+				t.Errorf("JapaneseIterationMarkCharFilter.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJapaneseIterationMarkCharFilter_FilterWithOffsets(t *testing.T) {
+	s := "人々 𠮷々"
+	got, corrector := NewJapaneseIterationMarkCharFilter().FilterWithOffsets(s)
+	if got != "人人 𠮷𠮷" {
+		t.Fatalf("JapaneseIterationMarkCharFilter.FilterWithOffsets() = %v, want %v", got, "人人 𠮷𠮷")
+	}
+	// "𠮷"は4バイト、"々"は3バイト
+	if start, end := corrector.Correct(7), corrector.CorrectEnd(15); s[start:end] != "𠮷々" {
+		t.Errorf("original of [7:15] = %q, want %q", s[start:end], "𠮷々")
+	}
+}
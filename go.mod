@@ -6,13 +6,18 @@ require (
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang/mock v1.6.0
 	github.com/google/go-cmp v0.5.5
+	github.com/ikawaha/kagome-dict v1.0.3
 	github.com/ikawaha/kagome-dict-ipa-neologd v0.2.0
+	github.com/ikawaha/kagome-dict/ipa v1.0.4
+	github.com/ikawaha/kagome-dict/uni v1.1.1
 	github.com/ikawaha/kagome/v2 v2.4.4
 	github.com/jmoiron/sqlx v1.3.4
 	github.com/k0kubun/colorstring v0.0.0-20150214042306-9440f1994b88 // indirect
 	github.com/k0kubun/pp v3.0.1+incompatible
-	github.com/kljensen/snowball v0.6.0
+	github.com/kljensen/snowball v0.9.0
 	github.com/kotaroooo0/gojaconv v0.0.0-20210223133819-8a8c2bab5241
 	github.com/mattn/go-colorable v0.1.11 // indirect
 	golang.org/x/exp v0.0.0-20210220032938-85be41e4509f // indirect
+	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v3 v3.0.1
 )
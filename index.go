@@ -72,3 +72,49 @@ func (p *Postings) PushBack(e *Postings) {
 	e.Next = p.Next
 	p.Next = e
 }
+
+// 転置インデックスを複製する
+// マージはポスティングリストを破壊的に変更するため、共有される転置インデックスは複製してから扱う
+func (ii InvertedIndex) Copy() InvertedIndex {
+	copied := make(InvertedIndex, len(ii))
+	for tokenID, postingList := range ii {
+		copied[tokenID] = postingList.Copy()
+	}
+	return copied
+}
+
+// ポスティングリストを複製する
+func (p PostingList) Copy() PostingList {
+	var head, tail *Postings
+	for pp := p.Postings; pp != nil; pp = pp.Next {
+		positions := make([]uint64, len(pp.Positions))
+		copy(positions, pp.Positions)
+		copied := NewPostings(pp.DocumentID, positions, nil)
+		if head == nil {
+			head = copied
+		} else {
+			tail.Next = copied
+		}
+		tail = copied
+	}
+	return NewPostingList(head)
+}
+
+// IDがidより小さいドキュメントのポスティングのみからなるポスティングリストを返す
+// 元のポスティングリストは変更しない
+func (p PostingList) before(id DocumentID) PostingList {
+	var head, tail *Postings
+	for pp := p.Postings; pp != nil; pp = pp.Next {
+		if pp.DocumentID >= id {
+			continue
+		}
+		copied := NewPostings(pp.DocumentID, pp.Positions, nil)
+		if head == nil {
+			head = copied
+		} else {
+			tail.Next = copied
+		}
+		tail = copied
+	}
+	return NewPostingList(head)
+}
@@ -1,70 +1,474 @@
 package stalefish
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrIndexerClosed = errors.New("indexer is closed")
+	ErrFlushFailed   = errors.New("periodic flush failed")
+)
+
+// 複数のゴルーチンから同時に利用できる
+// muはメモリ上の転置インデックス等の状態を、flushMuはストレージへのマージを保護する
 type Indexer struct {
+	mu                 sync.Mutex
+	flushMu            sync.Mutex
 	storage            Storage       // 永続化層
-	analyzer           Analyzer      // 文章分割のためのアナライザ
+	schema             Schema        // フィールドごとのアナライザ
 	invertedIndex      InvertedIndex // メモリ上の転置インデックス
+	flushing           InvertedIndex // ストレージへマージ中の転置インデックス
 	indexSizeThreshold int           // メモリ上の転置インデックスサイズをストレージへマージする閾値
+	maxBufferedDocs    int           // メモリ上に保持するドキュメント数の閾値(0なら無効)
+	maxBufferedBytes   int           // メモリ上に保持するドキュメント本文のバイト数の閾値(0なら無効)
+	flushInterval      time.Duration // 定期的にストレージへマージする間隔(0なら無効)
+	wal                *WAL          // マージされていないドキュメントを記録するWAL(nilなら無効)
+	bufferedDocs       int           // メモリ上に保持しているドキュメント数
+	bufferedBytes      int           // メモリ上に保持しているドキュメント本文のバイト数
+	flushErr           error         // 定期的なマージで発生し、まだ返していないエラー
+	addedDocs          int           // ストレージに追加したドキュメント数
+	firstDocID         DocumentID    // 最初に追加したドキュメントのID
+	lastDocID          DocumentID    // 最後に追加したドキュメントのID
+	closed             bool
+	done               chan struct{}
+	wg                 sync.WaitGroup
+}
+
+type IndexerOption func(*Indexer)
+
+// メモリ上に保持するドキュメント数がn以上になればストレージへマージする
+func WithMaxBufferedDocs(n int) IndexerOption {
+	return func(i *Indexer) {
+		i.maxBufferedDocs = n
+	}
 }
 
-func NewIndexer(storage Storage, analyzer Analyzer, indexSizeThreshold int) *Indexer {
-	return &Indexer{
+// メモリ上に保持するドキュメント本文のバイト数がn以上になればストレージへマージする
+func WithMaxBufferedBytes(n int) IndexerOption {
+	return func(i *Indexer) {
+		i.maxBufferedBytes = n
+	}
+}
+
+// 前回のマージからdだけ経過するごとにストレージへマージする
+func WithFlushInterval(d time.Duration) IndexerOption {
+	return func(i *Indexer) {
+		i.flushInterval = d
+	}
+}
+
+// マージされていないドキュメントをWALに記録する
+func WithWAL(wal *WAL) IndexerOption {
+	return func(i *Indexer) {
+		i.wal = wal
+	}
+}
+
+// analyzerでインデックスと検索をする本文のフィールドだけのスキーマを使う
+func NewIndexer(storage Storage, analyzer Analyzer, indexSizeThreshold int, options ...IndexerOption) *Indexer {
+	return NewIndexerWithSchema(storage, newBodySchema(analyzer), indexSizeThreshold, options...)
+}
+
+func NewIndexerWithSchema(storage Storage, schema Schema, indexSizeThreshold int, options ...IndexerOption) *Indexer {
+	indexer := &Indexer{
 		storage:            storage,
-		analyzer:           analyzer,
+		schema:             schema,
 		invertedIndex:      make(InvertedIndex),
 		indexSizeThreshold: indexSizeThreshold,
+		done:               make(chan struct{}),
+	}
+	for _, option := range options {
+		option(indexer)
+	}
+	if indexer.flushInterval > 0 {
+		indexer.wg.Add(1)
+		go indexer.flushPeriodically()
 	}
+	return indexer
 }
 
 // 転置インデックスにドキュメントを追加する
+// 複数のゴルーチンから同時に呼び出せる
+// 定期的なマージの失敗はドキュメントの追加とは無関係なので返さず、Err、Flush、Closeで返す
 func (i *Indexer) AddDocument(doc Document) error {
-	tokens := i.analyzer.Analyze(doc.Body)
-	doc.TokenCount = tokens.Size()
+	// 解析はロックの外で並行に行う
+	var postings documentPostings
+	postings, doc.TokenCount = i.schema.analyze(doc.Body)
+
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return ErrIndexerClosed
+	}
+
+	// ストレージに保存した後でクラッシュしてもインデックスできるように、保存前にWALへ記録
+	var walSize int64
+	if i.wal != nil {
+		count, err := i.storage.CountDocuments()
+		if err != nil {
+			i.mu.Unlock()
+			return err
+		}
+		if walSize, err = i.wal.Begin(doc.Body, count); err != nil {
+			i.mu.Unlock()
+			return err
+		}
+	}
 
 	// ストレージにドキュメントを保存し、ストレージの採番によりドキュメントIDを取得
 	docID, err := i.storage.AddDocument(doc)
 	if err != nil {
+		if i.wal != nil {
+			if rerr := i.wal.Rollback(walSize); rerr != nil {
+				err = fmt.Errorf("%v: %w", err, rerr)
+			}
+		}
+		i.mu.Unlock()
 		return err
 	}
-	doc.ID = docID
+	if i.wal != nil {
+		err = i.wal.Commit(docID)
+	}
 
-	// ドキュメントからメモリ上の転置インデックスを更新
-	if err := i.updateMemoryInvertedIndexByDocument(docID, tokens); err != nil {
+	// 保存したドキュメントは、WALへのIDの記録に失敗してもメモリ上の転置インデックスに追加する
+	// 記録できなかったIDはRecoverがストレージのドキュメント数から判定する
+	if ierr := i.indexDocument(docID, postings, len(doc.Body)); ierr != nil {
+		i.mu.Unlock()
+		return ierr
+	}
+	if err != nil {
+		i.mu.Unlock()
 		return err
 	}
 
 	// メモリ上の転置インデックスのサイズが閾値未満であれば、処理終了
 	// 閾値以上であれば、メモリの転置インデックスとストレージの転置インデックスをマージ
-	if len(i.invertedIndex) < i.indexSizeThreshold {
+	shouldFlush := i.shouldFlush()
+	i.mu.Unlock()
+	if !shouldFlush {
+		return nil
+	}
+	return i.flush()
+}
+
+// クエリがフィールドの検索時のアナライザを使えるように、インデックスのスキーマを返す
+func (i *Indexer) Schema() Schema {
+	return i.schema
+}
+
+// メモリ上の転置インデックスをストレージへマージすべきか判定する
+func (i *Indexer) shouldFlush() bool {
+	if len(i.invertedIndex) >= i.indexSizeThreshold {
+		return true
+	}
+	if i.maxBufferedDocs > 0 && i.bufferedDocs >= i.maxBufferedDocs {
+		return true
+	}
+	if i.maxBufferedBytes > 0 && i.bufferedBytes >= i.maxBufferedBytes {
+		return true
+	}
+	return false
+}
+
+// メモリ上の転置インデックスを閾値に関わらずストレージへマージする
+// マージに成功しても、まだ返していない定期的なマージの失敗があればErrFlushFailedを返す
+func (i *Indexer) Flush() error {
+	i.mu.Lock()
+	closed := i.closed
+	i.mu.Unlock()
+	if closed {
+		return ErrIndexerClosed
+	}
+	if err := i.flush(); err != nil {
+		return err
+	}
+	return i.Err()
+}
+
+// 定期的なマージが失敗していれば、まだ返していない最初のエラーをErrFlushFailedでラップして返す
+// 一度返したエラーは再び返さない
+// マージできなかった転置インデックスはメモリ上に残り、次のマージで再びストレージへのマージを試みる
+func (i *Indexer) Err() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.takeFlushErr()
+}
+
+// i.muを保持して呼び出す
+func (i *Indexer) takeFlushErr() error {
+	err := i.flushErr
+	if err == nil {
+		return nil
+	}
+	i.flushErr = nil
+	return fmt.Errorf("%w: %v", ErrFlushFailed, err)
+}
+
+// マージ中もドキュメントの追加とリーダーのRefreshを止めないように、
+// メモリ上の転置インデックスを退避してからロックの外でストレージとマージする
+func (i *Indexer) flush() error {
+	// マージは同時に一つだけ実行する
+	i.flushMu.Lock()
+	defer i.flushMu.Unlock()
+
+	i.mu.Lock()
+	if len(i.invertedIndex) == 0 && i.bufferedDocs == 0 {
+		i.mu.Unlock()
+		return nil
+	}
+	flushing, bufferedDocs, bufferedBytes := i.invertedIndex, i.bufferedDocs, i.bufferedBytes
+	var checkpoint int64
+	if i.wal != nil {
+		var err error
+		if checkpoint, err = i.wal.Size(); err != nil {
+			i.mu.Unlock()
+			return err
+		}
+	}
+	i.flushing = flushing
+	i.invertedIndex = InvertedIndex{}
+	i.bufferedDocs = 0
+	i.bufferedBytes = 0
+	i.mu.Unlock()
+
+	err := i.mergeIntoStorage(flushing)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.flushing = nil
+	if err != nil {
+		// マージに失敗したら退避した転置インデックスをメモリ上に戻す
+		for tokenID, postingList := range flushing {
+			i.invertedIndex[tokenID] = merge(postingList, i.invertedIndex[tokenID])
+		}
+		i.bufferedDocs += bufferedDocs
+		i.bufferedBytes += bufferedBytes
+		return err
+	}
+
+	// 永続化が完了したので、マージ中に追加されたドキュメントを残してWALを切り詰める
+	if i.wal != nil {
+		return i.wal.TruncateBefore(checkpoint)
+	}
+	return nil
+}
+
+// 転置インデックスをストレージ上の転置インデックスとマージして永続化する
+func (i *Indexer) mergeIntoStorage(invertedIndex InvertedIndex) error {
+	if len(invertedIndex) == 0 {
 		return nil
 	}
 
+	// セグメントに対応したストレージであれば、既存のポスティングリストを読まずに新しいセグメントとして書き込む
+	if w, ok := i.storage.(SegmentWriter); ok {
+		return w.WriteSegment(invertedIndex)
+	}
+
 	// マージ元の転置リストをストレージからREAD
-	storageInvertedIndex, err := i.storage.GetInvertedIndexByTokenIDs(i.invertedIndex.TokenIDs())
+	storageInvertedIndex, err := i.storage.GetInvertedIndexByTokenIDs(invertedIndex.TokenIDs())
 	if err != nil {
 		return err
 	}
 
 	// メモリ上の転置インデックスとストレージ上の転置インデックスをマージ
-	for tokenID, postingList := range i.invertedIndex {
-		i.invertedIndex[tokenID] = merge(postingList, storageInvertedIndex[tokenID])
+	merged := make(InvertedIndex, len(invertedIndex))
+	for tokenID, postingList := range invertedIndex {
+		merged[tokenID] = merge(postingList, storageInvertedIndex[tokenID])
 	}
 
 	// マージした転置インデックスをストレージで永続化
-	if err := i.storage.UpsertInvertedIndex(i.invertedIndex); err != nil {
+	return i.storage.UpsertInvertedIndex(merged)
+}
+
+func (i *Indexer) flushPeriodically() {
+	defer i.wg.Done()
+	ticker := time.NewTicker(i.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-i.done:
+			return
+		case <-ticker.C:
+			if err := i.flush(); err != nil {
+				i.mu.Lock()
+				if i.flushErr == nil {
+					i.flushErr = err
+				}
+				i.mu.Unlock()
+			}
+		}
+	}
+}
+
+// ドキュメントの追加がどこまで進んだかを表す時点
+type indexerCheckpoint struct {
+	addedDocs int        // 時点までに追加したドキュメント数
+	lastDocID DocumentID // 時点までに最後に追加したドキュメントのID
+}
+
+// メモリ上の転置インデックスの複製と、複製した時点を返す
+// マージ中の転置インデックスも含めるので、ストレージの更新途中でも取りこぼしはない
+func (i *Indexer) snapshot() (InvertedIndex, indexerCheckpoint) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	snapshot := i.invertedIndex.Copy()
+	for tokenID, postingList := range i.flushing {
+		snapshot[tokenID] = merge(snapshot[tokenID], postingList)
+	}
+	return snapshot, indexerCheckpoint{addedDocs: i.addedDocs, lastDocID: i.lastDocID}
+}
+
+// 時点より後に追加したドキュメントのIDの最小値を返す。追加していなければfalseを返す
+// ストレージはドキュメントIDを昇順に採番するので、これ以上のIDのドキュメントは時点より後に追加したものになる
+func (i *Indexer) addedSince(c indexerCheckpoint) (DocumentID, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.addedDocs == c.addedDocs {
+		return 0, false
+	}
+	if c.addedDocs == 0 {
+		return i.firstDocID, true
+	}
+	return c.lastDocID + 1, true
+}
+
+// 時点でのストレージのドキュメント数を返す
+func (i *Indexer) countDocumentsAt(c indexerCheckpoint) (int, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	count, err := i.storage.CountDocuments()
+	if err != nil {
+		return 0, err
+	}
+	return count - (i.addedDocs - c.addedDocs), nil
+}
+
+// ストレージに保存したドキュメントをメモリ上の転置インデックスに追加する
+// i.muを保持して呼び出す
+func (i *Indexer) indexDocument(docID DocumentID, postings documentPostings, size int) error {
+	if i.addedDocs == 0 {
+		i.firstDocID = docID
+	}
+	i.addedDocs++
+	i.lastDocID = docID
+
+	// ドキュメントからメモリ上の転置インデックスを更新
+	if err := i.updateMemoryInvertedIndexByDocument(docID, postings); err != nil {
 		return err
 	}
+	i.bufferedDocs++
+	i.bufferedBytes += size
+	return nil
+}
 
-	// メモリの転置インデックスをリセット
-	i.invertedIndex = InvertedIndex{}
+// WALに記録されたドキュメントからメモリ上の転置インデックスを復元し、ストレージへマージする
+// IDが確定したドキュメントはストレージに保存済みなので、転置インデックスのみを再構築する
+// ストレージへの保存の途中でクラッシュしたドキュメントは、保存されていなければ保存し直してからインデックスする
+func (i *Indexer) Recover() error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return ErrIndexerClosed
+	}
+	if i.wal == nil {
+		i.mu.Unlock()
+		return nil
+	}
+	pending, err := i.wal.replay(func(doc Document) error {
+		postings, _ := i.schema.analyze(doc.Body)
+		if err := i.updateMemoryInvertedIndexByDocument(doc.ID, postings); err != nil {
+			return err
+		}
+		i.bufferedDocs++
+		i.bufferedBytes += len(doc.Body)
+		return nil
+	})
+	if err == nil && pending != nil {
+		err = i.recoverPending(*pending)
+	}
+	i.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return i.flush()
+}
+
+// WALの末尾の保存を完了していないドキュメントを、ストレージへの保存とWALへのIDの記録を済ませてからインデックスする
+// ストレージのドキュメント数が記録した時点より増えていれば保存済みで、最も大きいIDのドキュメントがそのドキュメントになる
+// i.muを保持して呼び出す
+func (i *Indexer) recoverPending(pending walPending) error {
+	doc := NewDocument(pending.Body)
+	var postings documentPostings
+	postings, doc.TokenCount = i.schema.analyze(doc.Body)
+
+	count, err := i.storage.CountDocuments()
+	if err != nil {
+		return err
+	}
+	if count > pending.Count {
+		docs, err := i.storage.GetAllDocuments()
+		if err != nil {
+			return err
+		}
+		for _, d := range docs {
+			if d.ID > doc.ID {
+				doc.ID = d.ID
+			}
+		}
+	} else if doc.ID, err = i.storage.AddDocument(doc); err != nil {
+		return err
+	}
+	if err := i.wal.Commit(doc.ID); err != nil {
+		return err
+	}
+	if err := i.updateMemoryInvertedIndexByDocument(doc.ID, postings); err != nil {
+		return err
+	}
+	i.bufferedDocs++
+	i.bufferedBytes += len(doc.Body)
 	return nil
 }
 
+// メモリ上の転置インデックスをストレージへマージし、インデクサを停止する
+func (i *Indexer) Close() error {
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return nil
+	}
+	i.closed = true
+	i.mu.Unlock()
+
+	// 定期的なマージを停止
+	if i.done != nil {
+		close(i.done)
+	}
+	i.wg.Wait()
+
+	err := i.flush()
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err == nil {
+		err = i.takeFlushErr()
+	}
+	if i.wal != nil {
+		if werr := i.wal.Close(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
 // ドキュメントからメモリ上の転置インデックスを更新する
-func (i *Indexer) updateMemoryInvertedIndexByDocument(docID DocumentID, tokens TokenStream) error {
-	for pos, token := range tokens.Tokens {
-		if err := i.updateMemoryPostingListByToken(docID, token, uint64(pos)); err != nil {
-			return err
+func (i *Indexer) updateMemoryInvertedIndexByDocument(docID DocumentID, postings documentPostings) error {
+	for _, term := range postings.terms {
+		for _, position := range postings.positions[term] {
+			if err := i.updateMemoryPostingListByToken(docID, Token{Term: term}, position); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -80,7 +484,7 @@ func (i *Indexer) updateMemoryPostingListByToken(docID DocumentID, token Token,
 	var tokenID TokenID
 	if sToken == nil {
 		// トークンをストレージに保存しIDを採番
-		tokenID, err = i.storage.AddToken(NewToken(token.Term))
+		tokenID, err = i.storage.AddToken(Token{Term: token.Term})
 		if err != nil {
 			return err
 		}
@@ -131,42 +535,36 @@ func (i *Indexer) updateMemoryPostingListByToken(docID DocumentID, token Token,
 	return nil
 }
 
+// 2つのポスティングリストをドキュメントIDの昇順を保ってマージする
+// 検索中のリーダーとポスティングを共有しても安全なように、引数のポスティングリストは変更せず新しいリストを返す
+// 同じドキュメントのポスティングが両方に存在する時はoriginのものを採用する
 func merge(origin, target PostingList) PostingList {
-	if origin.Postings == nil {
-		return target
-	}
-	if target.Postings == nil {
-		return origin
-	}
-
-	merged := PostingList{
-		Postings: nil,
-	}
-	var smaller, larger *Postings
-	if origin.Postings.DocumentID <= target.Postings.DocumentID {
-		merged.Postings = origin.Postings
-		smaller, larger = origin.Postings, target.Postings
-	} else {
-		merged.Postings = target.Postings
-		smaller, larger = target.Postings, origin.Postings
-	}
-
-	for larger != nil {
-		if smaller.Next == nil {
-			smaller.Next = larger
-			break
+	var head, tail *Postings
+	push := func(p *Postings) {
+		positions := make([]uint64, len(p.Positions))
+		copy(positions, p.Positions)
+		copied := NewPostings(p.DocumentID, positions, nil)
+		if head == nil {
+			head = copied
+		} else {
+			tail.Next = copied
 		}
+		tail = copied
+	}
 
-		if smaller.Next.DocumentID < larger.DocumentID {
-			smaller = smaller.Next
-		} else if smaller.Next.DocumentID > larger.DocumentID {
-			largerNext, smallerNext := larger.Next, smaller.Next
-			smaller.Next, larger.Next = larger, smallerNext
-			smaller = larger
-			larger = largerNext
-		} else if smaller.Next.DocumentID == larger.DocumentID {
-			smaller, larger = smaller.Next, larger.Next
+	o, t := origin.Postings, target.Postings
+	for o != nil || t != nil {
+		switch {
+		case t == nil || (o != nil && o.DocumentID < t.DocumentID):
+			push(o)
+			o = o.Next
+		case o == nil || o.DocumentID > t.DocumentID:
+			push(t)
+			t = t.Next
+		default:
+			push(o)
+			o, t = o.Next, t.Next
 		}
 	}
-	return merged
+	return NewPostingList(head)
 }
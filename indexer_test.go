@@ -1,8 +1,14 @@
 package stalefish
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
@@ -34,7 +40,7 @@ func TestIndexer_AddDocument(t *testing.T) {
 			// Given
 			i := &Indexer{
 				storage:       mockStorage,
-				analyzer:      NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}),
+				schema:        newBodySchema(NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})),
 				invertedIndex: make(InvertedIndex),
 			}
 			invertedIndex := InvertedIndex(
@@ -50,7 +56,7 @@ func TestIndexer_AddDocument(t *testing.T) {
 			mockStorage.EXPECT().GetTokenByTerm("cc").Return(nil, nil).Times(1)
 			mockStorage.EXPECT().AddToken(Token{Term: "cc"}).Return(TokenID(2), nil).Times(1)
 			mockStorage.EXPECT().GetInvertedIndexByTokenIDs([]TokenID{0, 1, 2}).Return(invertedIndex, nil).Times(1)
-			mockStorage.EXPECT().UpsertInvertedIndex(invertedIndex).Times(1)
+			mockStorage.EXPECT().UpsertInvertedIndex(tt.expected).Times(1)
 
 			// When
 			if err := i.AddDocument(tt.doc); err != nil {
@@ -62,13 +68,16 @@ func TestIndexer_AddDocument(t *testing.T) {
 
 func TestIndexer_UpdateMemoryInvertedIndexByDocument(t *testing.T) {
 	cases := []struct {
-		docID       DocumentID
-		tokenStream TokenStream
-		expected    InvertedIndex
+		docID    DocumentID
+		postings documentPostings
+		expected InvertedIndex
 	}{
 		{
-			docID:       1,
-			tokenStream: TokenStream{[]Token{{Term: "aa"}, {Term: "bb"}, {Term: "cc"}, {Term: "aa"}}},
+			docID: 1,
+			postings: documentPostings{
+				terms:     []string{"aa", "bb", "cc"},
+				positions: map[string][]uint64{"aa": {0, 3}, "bb": {1}, "cc": {2}},
+			},
 			expected: InvertedIndex{
 				0: PostingList{
 					Postings: NewPostings(1, []uint64{0, 3}, nil),
@@ -84,7 +93,7 @@ func TestIndexer_UpdateMemoryInvertedIndexByDocument(t *testing.T) {
 	}
 
 	for _, tt := range cases {
-		t.Run(fmt.Sprintf("doc = %v, tokenStream = %v, expected = %v", tt.docID, tt.tokenStream, tt.expected), func(t *testing.T) {
+		t.Run(fmt.Sprintf("doc = %v, postings = %v, expected = %v", tt.docID, tt.postings, tt.expected), func(t *testing.T) {
 			// Mock
 			mockCtrl := gomock.NewController(t)
 			defer mockCtrl.Finish()
@@ -93,7 +102,7 @@ func TestIndexer_UpdateMemoryInvertedIndexByDocument(t *testing.T) {
 			// Given
 			indexer := &Indexer{
 				storage:       mockStorage,
-				analyzer:      Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}},
+				schema:        newBodySchema(Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}}),
 				invertedIndex: InvertedIndex{},
 			}
 			mockStorage.EXPECT().GetTokenByTerm("aa").Return(&Token{ID: 0, Term: "aa"}, nil).Times(2)
@@ -102,7 +111,7 @@ func TestIndexer_UpdateMemoryInvertedIndexByDocument(t *testing.T) {
 			mockStorage.EXPECT().AddToken(Token{Term: "cc"}).Return(TokenID(2), nil).Times(1)
 
 			// When
-			if err := indexer.updateMemoryInvertedIndexByDocument(tt.docID, tt.tokenStream); err != nil {
+			if err := indexer.updateMemoryInvertedIndexByDocument(tt.docID, tt.postings); err != nil {
 				t.Error(err)
 			}
 
@@ -181,8 +190,8 @@ func TestIndexer_UpdateMemoryInvertedIndexByToken(t *testing.T) {
 			mockStorage.EXPECT().GetTokenByTerm("abc").Return(&Token{ID: 3, Term: "abc"}, nil).AnyTimes()
 			mockStorage.EXPECT().GetTokenByTerm("abcd").Return(&Token{ID: 4, Term: "abcd"}, nil).AnyTimes()
 			indexer := &Indexer{
-				storage:  mockStorage,
-				analyzer: Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}},
+				storage: mockStorage,
+				schema:  newBodySchema(Analyzer{[]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}}),
 				invertedIndex: InvertedIndex{
 					TokenID(3): PostingList{
 						Postings: &Postings{DocumentID: 1, Positions: []uint64{1}, Next: nil},
@@ -277,3 +286,383 @@ func TestIndexer_Merge(t *testing.T) {
 		})
 	}
 }
+
+func TestIndexer_FlushPolicy(t *testing.T) {
+	cases := []struct {
+		options       []IndexerOption
+		bodies        []string
+		expectedFlush int
+	}{
+		{
+			// 閾値に達しないのでマージされない
+			options:       []IndexerOption{},
+			bodies:        []string{"aa", "bb", "cc"},
+			expectedFlush: 0,
+		},
+		{
+			// ドキュメント数の閾値
+			options:       []IndexerOption{WithMaxBufferedDocs(2)},
+			bodies:        []string{"aa", "bb", "cc", "dd"},
+			expectedFlush: 2,
+		},
+		{
+			// バイト数の閾値
+			options:       []IndexerOption{WithMaxBufferedBytes(5)},
+			bodies:        []string{"aa", "bb", "dddddd"},
+			expectedFlush: 1,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("bodies = %v, expectedFlush = %v", tt.bodies, tt.expectedFlush), func(t *testing.T) {
+			// Mock
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockStorage := NewMockStorage(mockCtrl)
+
+			// Given
+			mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(1), nil).Times(len(tt.bodies))
+			mockStorage.EXPECT().GetTokenByTerm(gomock.Any()).Return(&Token{ID: 1}, nil).Times(len(tt.bodies))
+			mockStorage.EXPECT().GetInvertedIndexByTokenIDs(gomock.Any()).Return(InvertedIndex{}, nil).Times(tt.expectedFlush)
+			mockStorage.EXPECT().UpsertInvertedIndex(gomock.Any()).Return(nil).Times(tt.expectedFlush)
+			indexer := NewIndexer(mockStorage, NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}), 100, tt.options...)
+
+			// When
+			for _, body := range tt.bodies {
+				if err := indexer.AddDocument(NewDocument(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexer_FlushInterval(t *testing.T) {
+	// Mock
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStorage := NewMockStorage(mockCtrl)
+
+	// Given
+	flushed := make(chan struct{}, 1)
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(1), nil)
+	mockStorage.EXPECT().GetTokenByTerm("aa").Return(&Token{ID: 1, Term: "aa"}, nil)
+	mockStorage.EXPECT().GetInvertedIndexByTokenIDs([]TokenID{1}).Return(InvertedIndex{}, nil)
+	mockStorage.EXPECT().UpsertInvertedIndex(gomock.Any()).DoAndReturn(func(InvertedIndex) error {
+		flushed <- struct{}{}
+		return nil
+	})
+	indexer := NewIndexer(mockStorage, NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}), 100, WithFlushInterval(10*time.Millisecond))
+
+	// When
+	if err := indexer.AddDocument(NewDocument("aa")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("buffered postings were not flushed")
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexer_FlushIntervalError(t *testing.T) {
+	// Mock
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStorage := NewMockStorage(mockCtrl)
+
+	// Given: 定期的なマージが失敗する
+	failed := make(chan struct{}, 1)
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(1), nil)
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(2), nil)
+	mockStorage.EXPECT().GetTokenByTerm("aa").Return(&Token{ID: 1, Term: "aa"}, nil)
+	mockStorage.EXPECT().GetTokenByTerm("bb").Return(&Token{ID: 2, Term: "bb"}, nil)
+	mockStorage.EXPECT().GetInvertedIndexByTokenIDs(gomock.Any()).Return(InvertedIndex{}, nil).AnyTimes()
+	mockStorage.EXPECT().UpsertInvertedIndex(gomock.Any()).DoAndReturn(func(InvertedIndex) error {
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+		return errors.New("storage is unavailable")
+	}).AnyTimes()
+	indexer := NewIndexer(mockStorage, NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}), 100, WithFlushInterval(10*time.Millisecond))
+	if err := indexer.AddDocument(NewDocument("aa")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("buffered postings were not flushed")
+	}
+
+	// When
+	err := indexer.AddDocument(NewDocument("bb"))
+
+	// Then: 次のAddDocumentは失敗せず、マージの失敗はErrで返す
+	if err != nil {
+		t.Errorf("AddDocument() = %v, want nil", err)
+	}
+	if err := indexer.Err(); !errors.Is(err, ErrFlushFailed) {
+		t.Errorf("Err() = %v, want %v", err, ErrFlushFailed)
+	}
+	if err := indexer.Close(); err == nil {
+		t.Error("Close() = nil, want error")
+	}
+}
+
+func TestIndexer_Close(t *testing.T) {
+	// Mock
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStorage := NewMockStorage(mockCtrl)
+
+	// Given
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(1), nil)
+	mockStorage.EXPECT().GetTokenByTerm("aa").Return(&Token{ID: 1, Term: "aa"}, nil)
+	mockStorage.EXPECT().GetInvertedIndexByTokenIDs([]TokenID{1}).Return(InvertedIndex{}, nil)
+	mockStorage.EXPECT().UpsertInvertedIndex(InvertedIndex{1: NewPostingList(NewPostings(1, []uint64{0}, nil))}).Return(nil)
+	indexer := NewIndexer(mockStorage, NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}), 100)
+	if err := indexer.AddDocument(NewDocument("aa")); err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	if err := indexer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then
+	if err := indexer.AddDocument(NewDocument("bb")); err != ErrIndexerClosed {
+		t.Errorf("AddDocument() after Close() = %v, want %v", err, ErrIndexerClosed)
+	}
+}
+
+func TestIndexer_Recover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stalefish.wal")
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+
+	// Mock
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStorage := NewMockStorage(mockCtrl)
+
+	// Given: マージ前にプロセスが終了
+	mockStorage.EXPECT().CountDocuments().Return(0, nil)
+	mockStorage.EXPECT().CountDocuments().Return(1, nil)
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(1), nil)
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(DocumentID(2), nil)
+	mockStorage.EXPECT().GetTokenByTerm("aa").Return(&Token{ID: 1, Term: "aa"}, nil).Times(4)
+	mockStorage.EXPECT().GetTokenByTerm("bb").Return(&Token{ID: 2, Term: "bb"}, nil).Times(2)
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := NewIndexer(mockStorage, analyzer, 100, WithWAL(wal))
+	for _, body := range []string{"aa bb", "aa"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wal.Close()
+
+	// When: 再起動
+	mockStorage.EXPECT().GetInvertedIndexByTokenIDs([]TokenID{1, 2}).Return(InvertedIndex{}, nil)
+	mockStorage.EXPECT().UpsertInvertedIndex(InvertedIndex{
+		1: NewPostingList(NewPostings(1, []uint64{0}, NewPostings(2, []uint64{0}, nil))),
+		2: NewPostingList(NewPostings(1, []uint64{1}, nil)),
+	}).Return(nil)
+	wal, err = OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer = NewIndexer(mockStorage, analyzer, 100, WithWAL(wal))
+	if err := indexer.Recover(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then: マージ済みなのでWALは空になる
+	if err := indexer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("WAL was not truncated: info = %v, err = %v", info, err)
+	}
+}
+
+// ストレージへの保存の前後でクラッシュしたドキュメントを、一度だけ保存してインデックスする
+func TestIndexer_Recover_Pending(t *testing.T) {
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	tests := []struct {
+		name   string
+		stored bool
+	}{
+		{name: "crash before storing", stored: false},
+		{name: "crash after storing", stored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stalefish.wal")
+			storage := newMemoryStorage()
+			wal, err := OpenWAL(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			indexer := NewIndexer(storage, analyzer, 100, WithWAL(wal))
+			if err := indexer.AddDocument(NewDocument("aa bb")); err != nil {
+				t.Fatal(err)
+			}
+
+			// Given: WALに記録した後、IDを記録する前にプロセスが終了
+			if _, err := wal.Begin("bb cc", 1); err != nil {
+				t.Fatal(err)
+			}
+			if tt.stored {
+				if _, err := storage.AddDocument(NewDocument("bb cc")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wal.Close()
+
+			// When: 再起動して2回復元する
+			for n := 0; n < 2; n++ {
+				wal, err = OpenWAL(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				indexer = NewIndexer(storage, analyzer, 100, WithWAL(wal))
+				if err := indexer.Recover(); err != nil {
+					t.Fatal(err)
+				}
+				if err := indexer.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Then
+			if count, _ := storage.CountDocuments(); count != 2 {
+				t.Errorf("CountDocuments() = %v, want 2", count)
+			}
+			docs, err := NewPhraseQuery("bb", analyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(len(docs), 2); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+			inverted, err := storage.GetInvertedIndexByTokenIDs([]TokenID{2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(inverted[2].Postings, NewPostings(1, []uint64{1}, NewPostings(2, []uint64{0}, nil))); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIndexer_Concurrent(t *testing.T) {
+	const (
+		writers      = 8
+		docsByWriter = 50
+		readers      = 4
+	)
+	storage := newMemoryStorage()
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	wal, err := OpenWAL(filepath.Join(t.TempDir(), "stalefish.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexer := NewIndexer(storage, analyzer, 100, WithMaxBufferedDocs(7), WithFlushInterval(time.Millisecond), WithWAL(wal))
+	reader := NewIndexReader(indexer, WithRefreshInterval(time.Millisecond))
+	defer reader.Close()
+
+	// ドキュメントを並行に追加しながら、並行に検索する
+	var writerWg, readerWg sync.WaitGroup
+	stop := make(chan struct{})
+	errs := make(chan error, writers+readers)
+	for w := 0; w < writers; w++ {
+		writerWg.Add(1)
+		go func(w int) {
+			defer writerWg.Done()
+			for d := 0; d < docsByWriter; d++ {
+				if err := indexer.AddDocument(NewDocument(fmt.Sprintf("common writer%d doc%d", w, d))); err != nil {
+					errs <- err
+					return
+				}
+				if d%10 == 0 {
+					if err := indexer.Flush(); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < readers; r++ {
+		readerWg.Add(1)
+		go func(r int) {
+			defer readerWg.Done()
+			query := NewMatchQuery(fmt.Sprintf("writer%d", r), AND, analyzer, NewTfIdfSorter(reader))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				reader.Refresh()
+				docs, err := query.Searcher(reader).Search()
+				if err != nil {
+					errs <- err
+					return
+				}
+				// 他のライターのドキュメントが混ざらない
+				for _, doc := range docs {
+					if !strings.Contains(doc.Body, fmt.Sprintf("writer%d ", r)) {
+						errs <- fmt.Errorf("unexpected document %v for writer%d", doc, r)
+						return
+					}
+				}
+			}
+		}(r)
+	}
+	writerWg.Wait()
+	close(stop)
+	readerWg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if err := indexer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 全てのドキュメントがストレージにマージされている
+	docs, err := NewMatchQuery("common", AND, analyzer, nil).Searcher(storage).Search()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != writers*docsByWriter {
+		t.Errorf("len(docs) = %v, want %v", len(docs), writers*docsByWriter)
+	}
+}
+
+func TestIndexer_MergeDoesNotModifyArguments(t *testing.T) {
+	origin := NewPostingList(NewPostings(1, []uint64{0}, NewPostings(3, []uint64{1}, nil)))
+	target := NewPostingList(NewPostings(2, []uint64{2}, NewPostings(3, []uint64{1}, nil)))
+
+	merged := merge(origin, target)
+
+	if diff := cmp.Diff(merged, NewPostingList(NewPostings(1, []uint64{0}, NewPostings(2, []uint64{2}, NewPostings(3, []uint64{1}, nil))))); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if diff := cmp.Diff(origin, NewPostingList(NewPostings(1, []uint64{0}, NewPostings(3, []uint64{1}, nil)))); diff != "" {
+		t.Errorf("origin was modified: (-got +want)\n%s", diff)
+	}
+	if diff := cmp.Diff(target, NewPostingList(NewPostings(2, []uint64{2}, NewPostings(3, []uint64{1}, nil)))); diff != "" {
+		t.Errorf("target was modified: (-got +want)\n%s", diff)
+	}
+}
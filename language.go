@@ -0,0 +1,140 @@
+package stalefish
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/kljensen/snowball/french"
+	"github.com/kljensen/snowball/hungarian"
+	"github.com/kljensen/snowball/norwegian"
+	"github.com/kljensen/snowball/russian"
+	"github.com/kljensen/snowball/spanish"
+	"github.com/kljensen/snowball/swedish"
+)
+
+// 言語
+// 値はSnowballの言語名に合わせる
+type Language string
+
+const (
+	English   Language = "english"
+	French    Language = "french"
+	Spanish   Language = "spanish"
+	Russian   Language = "russian"
+	Swedish   Language = "swedish"
+	Norwegian Language = "norwegian"
+	Hungarian Language = "hungarian"
+	Japanese  Language = "japanese"
+)
+
+var snowballStemmers = map[Language]func(string, bool) string{
+	English:   english.Stem,
+	French:    french.Stem,
+	Spanish:   spanish.Stem,
+	Russian:   russian.Stem,
+	Swedish:   swedish.Stem,
+	Norwegian: norwegian.Stem,
+	Hungarian: hungarian.Stem,
+}
+
+// StemmerFilterで語幹を取り出せる言語
+func StemmerLanguages() []Language {
+	return []Language{English, French, Spanish, Russian, Swedish, Norwegian, Hungarian}
+}
+
+// StopWordFilterに渡す言語ごとのストップワード
+// 対応していない言語ならnilを返す
+func DefaultStopWords(language Language) []string {
+	words, ok := defaultStopWords[language]
+	if !ok {
+		return nil
+	}
+	r := make([]string, len(words))
+	copy(r, words)
+	return r
+}
+
+// 文字列の言語を判定する
+// 判定できなければ空文字列を返す
+type LanguageIdentifier interface {
+	Identify(string) Language
+}
+
+// 文字の種類から言語を判定する
+// 最も多い文字の種類で、かなと漢字なら日本語、キリル文字ならロシア語とする
+// かなと漢字は1文字が単語に近いので文字の数、ラテン文字とキリル文字は単語の数で比べる
+// ラテン文字が最も多ければ候補の言語のうちストップワードを最も多く含む言語とし、同数なら先に指定した言語を選ぶ
+type ScriptLanguageIdentifier struct {
+	latinLanguages []Language
+}
+
+// latinLanguagesを指定しなければ英語とする
+func NewScriptLanguageIdentifier(latinLanguages ...Language) ScriptLanguageIdentifier {
+	if len(latinLanguages) == 0 {
+		latinLanguages = []Language{English}
+	}
+	return ScriptLanguageIdentifier{
+		latinLanguages: latinLanguages,
+	}
+}
+
+func (i ScriptLanguageIdentifier) Identify(s string) Language {
+	var japanese, latin, cyrillic int
+	// 直前の文字の種類。ラテン文字とキリル文字は種類が変わった所を単語の始まりとする
+	var prev *unicode.RangeTable
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han):
+			japanese++
+			prev = nil
+		case unicode.Is(unicode.Latin, r):
+			if prev != unicode.Latin {
+				latin++
+			}
+			prev = unicode.Latin
+		case unicode.Is(unicode.Cyrillic, r):
+			if prev != unicode.Cyrillic {
+				cyrillic++
+			}
+			prev = unicode.Cyrillic
+		default:
+			prev = nil
+		}
+	}
+	switch {
+	case japanese > 0 && japanese >= latin && japanese >= cyrillic:
+		return Japanese
+	case cyrillic > 0 && cyrillic >= latin:
+		return Russian
+	case latin > 0:
+		return i.identifyLatin(s)
+	}
+	return ""
+}
+
+func (i ScriptLanguageIdentifier) identifyLatin(s string) Language {
+	if len(i.latinLanguages) == 1 {
+		return i.latinLanguages[0]
+	}
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	best, bestCount := i.latinLanguages[0], 0
+	for _, language := range i.latinLanguages {
+		stopWords := make(map[string]struct{}, len(defaultStopWords[language]))
+		for _, w := range defaultStopWords[language] {
+			stopWords[w] = struct{}{}
+		}
+		count := 0
+		for _, w := range words {
+			if _, ok := stopWords[w]; ok {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = language, count
+		}
+	}
+	return best
+}
@@ -0,0 +1,71 @@
+package stalefish
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScriptLanguageIdentifier_Identify(t *testing.T) {
+	cases := []struct {
+		latinLanguages []Language
+		text           string
+		expected       Language
+	}{
+		{
+			text:     "今日は天気が良い",
+			expected: Japanese,
+		},
+		{
+			text:     "Elasticsearchの使い方",
+			expected: Japanese,
+		},
+		{
+			text:     "東京都",
+			expected: Japanese,
+		},
+		{
+			// かなを含んでも英語の単語の方が多ければ英語とする
+			text:     "I love スキー in Hakuba",
+			expected: English,
+		},
+		{
+			text:     "HakubaのスキーとNiseko",
+			expected: Japanese,
+		},
+		{
+			text:     "The quick brown fox",
+			expected: English,
+		},
+		{
+			text:     "Книги на столе",
+			expected: Russian,
+		},
+		{
+			text:     "12345",
+			expected: "",
+		},
+		{
+			latinLanguages: []Language{English, French, Spanish},
+			text:           "Le chat est sur la table",
+			expected:       French,
+		},
+		{
+			latinLanguages: []Language{English, French, Spanish},
+			text:           "El perro y los gatos",
+			expected:       Spanish,
+		},
+		{
+			latinLanguages: []Language{English, French, Spanish},
+			text:           "Stalefish",
+			expected:       English,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("latinLanguages = %v, text = %v, expected = %v", tt.latinLanguages, tt.text, tt.expected), func(t *testing.T) {
+			if actual := NewScriptLanguageIdentifier(tt.latinLanguages...).Identify(tt.text); actual != tt.expected {
+				t.Errorf("ScriptLanguageIdentifier.Identify() = %v, want %v", actual, tt.expected)
+			}
+		})
+	}
+}
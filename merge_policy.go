@@ -0,0 +1,84 @@
+package stalefish
+
+import (
+	"math"
+	"sort"
+)
+
+type SegmentID uint64
+
+// マージポリシーの判断材料となるセグメントの情報
+type SegmentInfo struct {
+	ID   SegmentID
+	Size int // セグメントに含まれるポスティングの数
+}
+
+// セグメントの一覧から、マージすべきセグメントの組を選ぶ
+type MergePolicy interface {
+	FindMerges([]SegmentInfo) [][]SegmentID
+}
+
+// サイズが近いセグメントを同じ階層にまとめ、階層内のセグメント数が一定を超えたらマージする
+// LuceneのTieredMergePolicyを簡略化したもの
+// segmentsPerTierが2未満の時はマージしない
+type TieredMergePolicy struct {
+	segmentsPerTier  int // 一つの階層に許容するセグメント数
+	maxMergeAtOnce   int // 一度にマージするセグメント数の上限
+	floorSegmentSize int // これより小さいセグメントは全て最下層として扱う
+}
+
+func NewTieredMergePolicy(segmentsPerTier, maxMergeAtOnce, floorSegmentSize int) TieredMergePolicy {
+	return TieredMergePolicy{
+		segmentsPerTier:  segmentsPerTier,
+		maxMergeAtOnce:   maxMergeAtOnce,
+		floorSegmentSize: floorSegmentSize,
+	}
+}
+
+func (p TieredMergePolicy) FindMerges(segments []SegmentInfo) [][]SegmentID {
+	if p.segmentsPerTier < 2 {
+		return nil
+	}
+
+	// セグメントをサイズから階層に振り分ける
+	// 階層tには floorSegmentSize * segmentsPerTier^t 程度のサイズのセグメントが入る
+	tiers := make(map[int][]SegmentInfo)
+	for _, s := range segments {
+		tier := 0
+		if s.Size > p.floorSegmentSize && p.floorSegmentSize > 0 {
+			tier = int(math.Log(float64(s.Size)/float64(p.floorSegmentSize)) / math.Log(float64(p.segmentsPerTier)))
+		}
+		tiers[tier] = append(tiers[tier], s)
+	}
+
+	levels := make([]int, 0, len(tiers))
+	for tier := range tiers {
+		levels = append(levels, tier)
+	}
+	sort.Ints(levels)
+
+	merges := [][]SegmentID{}
+	for _, tier := range levels {
+		infos := tiers[tier]
+		if len(infos) < p.segmentsPerTier {
+			continue
+		}
+		// 小さいセグメントから優先してマージする
+		sort.Slice(infos, func(i, j int) bool {
+			if infos[i].Size == infos[j].Size {
+				return infos[i].ID < infos[j].ID
+			}
+			return infos[i].Size < infos[j].Size
+		})
+		n := len(infos)
+		if p.maxMergeAtOnce > 1 && n > p.maxMergeAtOnce {
+			n = p.maxMergeAtOnce
+		}
+		ids := make([]SegmentID, n)
+		for i := 0; i < n; i++ {
+			ids[i] = infos[i].ID
+		}
+		merges = append(merges, ids)
+	}
+	return merges
+}
@@ -0,0 +1,48 @@
+package stalefish
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTieredMergePolicy_FindMerges(t *testing.T) {
+	tests := []struct {
+		policy   TieredMergePolicy
+		segments []SegmentInfo
+		expected [][]SegmentID
+	}{
+		{
+			// 階層内のセグメント数が閾値未満
+			policy:   NewTieredMergePolicy(3, 10, 10),
+			segments: []SegmentInfo{{ID: 1, Size: 5}, {ID: 2, Size: 8}},
+			expected: [][]SegmentID{},
+		},
+		{
+			// 最下層のセグメントをマージ
+			policy:   NewTieredMergePolicy(3, 10, 10),
+			segments: []SegmentInfo{{ID: 1, Size: 5}, {ID: 2, Size: 8}, {ID: 3, Size: 100}, {ID: 4, Size: 2}},
+			expected: [][]SegmentID{{4, 1, 2}},
+		},
+		{
+			// 一度にマージするセグメント数の上限
+			policy:   NewTieredMergePolicy(3, 2, 10),
+			segments: []SegmentInfo{{ID: 1, Size: 5}, {ID: 2, Size: 8}, {ID: 3, Size: 2}},
+			expected: [][]SegmentID{{3, 1}},
+		},
+		{
+			// 階層ごとにマージ
+			policy:   NewTieredMergePolicy(2, 10, 10),
+			segments: []SegmentInfo{{ID: 1, Size: 5}, {ID: 2, Size: 8}, {ID: 3, Size: 25}, {ID: 4, Size: 30}, {ID: 5, Size: 1000}},
+			expected: [][]SegmentID{{1, 2}, {3, 4}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("segments = %v, expected = %v", tt.segments, tt.expected), func(t *testing.T) {
+			if diff := cmp.Diff(tt.policy.FindMerges(tt.segments), tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
@@ -93,6 +93,21 @@ func (mr *MockStorageMockRecorder) GetAllDocuments() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllDocuments", reflect.TypeOf((*MockStorage)(nil).GetAllDocuments))
 }
 
+// GetAllTokens mocks base method.
+func (m *MockStorage) GetAllTokens() ([]Token, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllTokens")
+	ret0, _ := ret[0].([]Token)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllTokens indicates an expected call of GetAllTokens.
+func (mr *MockStorageMockRecorder) GetAllTokens() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllTokens", reflect.TypeOf((*MockStorage)(nil).GetAllTokens))
+}
+
 // GetDocuments mocks base method.
 func (m *MockStorage) GetDocuments(arg0 []DocumentID) ([]Document, error) {
 	m.ctrl.T.Helper()
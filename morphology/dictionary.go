@@ -0,0 +1,75 @@
+package morphology
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	ipaneologd "github.com/ikawaha/kagome-dict-ipa-neologd"
+	"github.com/ikawaha/kagome-dict/dict"
+)
+
+var ErrDictionaryNotFound = errors.New("dictionary not found")
+
+// 辞書の名前
+const (
+	IPA     = "ipa"     // IPA辞書
+	UniDic  = "unidic"  // UniDic
+	NEologd = "neologd" // IPA辞書に新語・固有名詞を追加したmecab-ipadic-NEologd
+)
+
+// Kagomeのシステム辞書
+// 辞書のデータはそれぞれ大きいので、このパッケージはデフォルトのNEologdだけをリンクして登録する
+// 他の辞書はパッケージ(morphology/ipa、morphology/unidic)をインポートすると、その辞書だけがリンクされて名前で登録される
+type Dictionary struct {
+	name string
+	load func() *dict.Dict
+}
+
+// loadは最初に辞書を使う時に呼ばれる
+func NewDictionary(name string, load func() *dict.Dict) Dictionary {
+	return Dictionary{
+		name: name,
+		load: load,
+	}
+}
+
+func (d Dictionary) Name() string {
+	return d.name
+}
+
+// NewKagomeが辞書を指定しない時に使うNEologd
+var DefaultDictionary = NewDictionary(NEologd, ipaneologd.Dict)
+
+var (
+	dictionariesMu sync.RWMutex
+	dictionaries   = map[string]Dictionary{NEologd: DefaultDictionary}
+)
+
+// 辞書を名前で登録する。辞書のパッケージのinitから呼ぶ
+func RegisterDictionary(d Dictionary) {
+	dictionariesMu.Lock()
+	defer dictionariesMu.Unlock()
+	dictionaries[d.name] = d
+}
+
+// 登録された辞書を名前で探す
+func LookupDictionary(name string) (Dictionary, error) {
+	dictionariesMu.RLock()
+	defer dictionariesMu.RUnlock()
+	d, ok := dictionaries[name]
+	if !ok {
+		return Dictionary{}, fmt.Errorf("%w: %q (registered: %v)", ErrDictionaryNotFound, name, registeredDictionaries())
+	}
+	return d, nil
+}
+
+func registeredDictionaries() []string {
+	names := make([]string, 0, len(dictionaries))
+	for name := range dictionaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,14 @@
+// IPA辞書
+// インポートするとmorphology.IPAの名前で登録される
+package ipa
+
+import (
+	kagomeipa "github.com/ikawaha/kagome-dict/ipa"
+	"github.com/kotaroooo0/stalefish/morphology"
+)
+
+var Dictionary = morphology.NewDictionary(morphology.IPA, kagomeipa.Dict)
+
+func init() {
+	morphology.RegisterDictionary(Dictionary)
+}
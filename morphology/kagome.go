@@ -1,38 +1,159 @@
 package morphology
 
 import (
-	ipaneologd "github.com/ikawaha/kagome-dict-ipa-neologd"
+	"strings"
+
+	"github.com/ikawaha/kagome-dict/dict"
 	"github.com/ikawaha/kagome/v2/tokenizer"
 )
 
+// 解析モード
+type Mode int
+
+const (
+	Normal   Mode = iota + 1 // 通常の分割
+	Search                   // 検索向けに長い名詞を分割する
+	Extended                 // Searchに加えて未知語を1文字ずつに分割する
+)
+
 // github.com/ikawaha/kagomeに直接依存しないようにラップする
 type Kagome struct {
-	kagome *tokenizer.Tokenizer
+	kagome       *tokenizer.Tokenizer
+	dictionary   *Dictionary
+	userDictPath string
+	mode         Mode
+}
+
+type KagomeOption func(*Kagome)
+
+func WithDictionary(dictionary Dictionary) KagomeOption {
+	return func(k *Kagome) {
+		k.dictionary = &dictionary
+	}
+}
+
+// ユーザー辞書のファイルを読み込む
+// 各行は"テキスト,分割したテキスト,読み,品詞"の形式で、分割したテキストと読みは空白で区切る
+func WithUserDictionary(path string) KagomeOption {
+	return func(k *Kagome) {
+		k.userDictPath = path
+	}
 }
 
-func NewKagome() (*Kagome, error) {
-	tokenizer, err := tokenizer.New(ipaneologd.Dict(), tokenizer.OmitBosEos())
+func WithMode(mode Mode) KagomeOption {
+	return func(k *Kagome) {
+		k.mode = mode
+	}
+}
+
+// デフォルトではNEologdをSearchモードで使う
+func NewKagome(options ...KagomeOption) (*Kagome, error) {
+	k := &Kagome{
+		mode: Search,
+	}
+	for _, option := range options {
+		option(k)
+	}
+	if k.dictionary == nil {
+		d := DefaultDictionary
+		k.dictionary = &d
+	}
+
+	tokenizerOptions := []tokenizer.Option{tokenizer.OmitBosEos()}
+	if k.userDictPath != "" {
+		userDict, err := dict.NewUserDict(k.userDictPath)
+		if err != nil {
+			return nil, err
+		}
+		tokenizerOptions = append(tokenizerOptions, tokenizer.UserDict(userDict))
+	}
+	t, err := tokenizer.New(k.dictionary.load(), tokenizerOptions...)
 	if err != nil {
 		return nil, err
 	}
-	return &Kagome{
-		kagome: tokenizer,
-	}, nil
+	k.kagome = t
+	return k, nil
 }
 
+func (k *Kagome) tokenizeMode() tokenizer.TokenizeMode {
+	switch k.mode {
+	case Normal:
+		return tokenizer.Normal
+	case Extended:
+		return tokenizer.Extended
+	}
+	return tokenizer.Search
+}
+
+// 辞書によって素性の並びが異なるので、素性の位置は辞書のメタ情報から求める
+// 未知語は読み以降を持たない
 func (k *Kagome) Analyze(text string) []MorphologyToken {
-	tokens := k.kagome.Analyze(text, tokenizer.Search)
+	tokens := k.kagome.Analyze(text, k.tokenizeMode())
 	kagomeTokens := make([]MorphologyToken, 0)
 	for _, token := range tokens {
-		features := token.Features()
-		if features[1] == "空白" {
+		pos := token.POS()
+		if isSpace(pos) {
 			continue
 		}
-		kana := token.Surface
-		if len(features) >= 8 {
-			kana = features[7]
+		kana := reading(token)
+		baseForm := token.Surface
+		if f, ok := token.BaseForm(); ok && f != "*" {
+			baseForm = f
 		}
-		kagomeTokens = append(kagomeTokens, NewMorphologyToken(token.Surface, kana))
+		inflectionType, _ := token.InflectionalType()
+		inflectionForm, _ := token.InflectionalForm()
+		kagomeTokens = append(kagomeTokens, NewMorphologyToken(token.Surface, kana,
+			WithPartOfSpeech(partOfSpeech(pos)),
+			WithBaseForm(baseForm),
+			WithInflection(feature(inflectionType), feature(inflectionForm)),
+		))
 	}
 	return kagomeTokens
 }
+
+func isSpace(pos []string) bool {
+	for _, p := range pos {
+		if p == "空白" {
+			return true
+		}
+	}
+	return false
+}
+
+// 読みを持たない辞書(UniDic)では発音を使い、どちらもなければ表層形を使う
+// ユーザー辞書の読みは分割したテキストごとに区切られているので繋げる
+func reading(token tokenizer.Token) string {
+	if token.Class == tokenizer.USER {
+		if yomi, ok := token.FeatureAt(2); ok && yomi != "" {
+			return strings.Replace(yomi, "/", "", -1)
+		}
+		return token.Surface
+	}
+	if r, ok := token.Reading(); ok && r != "*" {
+		return r
+	}
+	if p, ok := token.Pronunciation(); ok && p != "*" {
+		return p
+	}
+	return token.Surface
+}
+
+// 品詞と品詞細分類を"-"で繋げる
+func partOfSpeech(pos []string) string {
+	r := make([]string, 0, len(pos))
+	for _, p := range pos {
+		if p == "*" {
+			break
+		}
+		r = append(r, p)
+	}
+	return strings.Join(r, "-")
+}
+
+// 値がない素性は"*"になっている
+func feature(f string) string {
+	if f == "*" {
+		return ""
+	}
+	return f
+}
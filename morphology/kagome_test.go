@@ -1,12 +1,29 @@
 package morphology
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	kagomeipa "github.com/ikawaha/kagome-dict/ipa"
+	"github.com/ikawaha/kagome-dict/uni"
 )
 
+// 辞書のパッケージはこのパッケージをインポートするので、テストでは辞書を直接登録する
+// NEologdはデフォルトで登録されている
+var (
+	ipaDictionary    = NewDictionary(IPA, kagomeipa.Dict)
+	unidicDictionary = NewDictionary(UniDic, uni.Dict)
+)
+
+func init() {
+	RegisterDictionary(ipaDictionary)
+	RegisterDictionary(unidicDictionary)
+}
+
 func TestAnalyze(t *testing.T) {
 	cases := []struct {
 		text     string
@@ -15,77 +32,77 @@ func TestAnalyze(t *testing.T) {
 		{
 			text: "今日は天気が良い",
 			expected: []MorphologyToken{
-				NewMorphologyToken("今日", "キョウ"),
-				NewMorphologyToken("は", "ハ"),
-				NewMorphologyToken("天気", "テンキ"),
-				NewMorphologyToken("が", "ガ"),
-				NewMorphologyToken("良い", "ヨイ"),
+				NewMorphologyToken("今日", "キョウ", WithPartOfSpeech("名詞-副詞可能"), WithBaseForm("今日")),
+				NewMorphologyToken("は", "ハ", WithPartOfSpeech("助詞-係助詞"), WithBaseForm("は")),
+				NewMorphologyToken("天気", "テンキ", WithPartOfSpeech("名詞-一般"), WithBaseForm("天気")),
+				NewMorphologyToken("が", "ガ", WithPartOfSpeech("助詞-格助詞-一般"), WithBaseForm("が")),
+				NewMorphologyToken("良い", "ヨイ", WithPartOfSpeech("形容詞-自立"), WithBaseForm("良い"), WithInflection("形容詞・アウオ段", "基本形")),
 			},
 		},
 		{
 			text: "白馬へ滑りにいきたい",
 			expected: []MorphologyToken{
-				NewMorphologyToken("白馬", "ハクバ"),
-				NewMorphologyToken("へ", "ヘ"),
-				NewMorphologyToken("滑り", "スベリ"),
-				NewMorphologyToken("に", "ニ"),
-				NewMorphologyToken("いき", "イキ"),
-				NewMorphologyToken("たい", "タイ"),
+				NewMorphologyToken("白馬", "ハクバ", WithPartOfSpeech("名詞-一般"), WithBaseForm("白馬")),
+				NewMorphologyToken("へ", "ヘ", WithPartOfSpeech("助詞-格助詞-一般"), WithBaseForm("へ")),
+				NewMorphologyToken("滑り", "スベリ", WithPartOfSpeech("名詞-一般"), WithBaseForm("滑り")),
+				NewMorphologyToken("に", "ニ", WithPartOfSpeech("助詞-格助詞-一般"), WithBaseForm("に")),
+				NewMorphologyToken("いき", "イキ", WithPartOfSpeech("動詞-自立"), WithBaseForm("いく"), WithInflection("五段・カ行促音便", "連用形")),
+				NewMorphologyToken("たい", "タイ", WithPartOfSpeech("助動詞"), WithBaseForm("たい"), WithInflection("特殊・タイ", "基本形")),
 			},
 		},
 		{
 			text: "Ishiuchi Maruyama",
 			expected: []MorphologyToken{
-				NewMorphologyToken("Ishiuchi", "Ishiuchi"),
-				NewMorphologyToken("Maruyama", "Maruyama"),
+				NewMorphologyToken("Ishiuchi", "Ishiuchi", WithPartOfSpeech("名詞-固有名詞-組織"), WithBaseForm("Ishiuchi")),
+				NewMorphologyToken("Maruyama", "Maruyama", WithPartOfSpeech("名詞-固有名詞-組織"), WithBaseForm("Maruyama")),
 			},
 		},
 		{
 			text: "石打丸山スキー場",
 			expected: []MorphologyToken{
-				NewMorphologyToken("石打丸山スキー場", "イシウチマルヤマスキージョウ"),
+				NewMorphologyToken("石打丸山スキー場", "イシウチマルヤマスキージョウ", WithPartOfSpeech("名詞-固有名詞-一般"), WithBaseForm("石打丸山スキー場")),
 			},
 		},
 		{
 			text: "石打丸山",
 			expected: []MorphologyToken{
-				NewMorphologyToken("石打丸山", "イシウチマルヤマ"),
+				NewMorphologyToken("石打丸山", "イシウチマルヤマ", WithPartOfSpeech("名詞-固有名詞-一般"), WithBaseForm("石打丸山")),
 			},
 		},
 		{
 			text: "いしうちまるやま",
 			expected: []MorphologyToken{
-				NewMorphologyToken("い", "イ"),
-				NewMorphologyToken("し", "シ"),
-				NewMorphologyToken("うち", "ウチ"),
-				NewMorphologyToken("まるや", "マルヤ"),
-				NewMorphologyToken("ま", "マ"),
+				NewMorphologyToken("い", "イ", WithPartOfSpeech("動詞-自立"), WithBaseForm("いる"), WithInflection("一段", "連用形")),
+				NewMorphologyToken("し", "シ", WithPartOfSpeech("助動詞"), WithBaseForm("き"), WithInflection("文語・キ", "体言接続")),
+				NewMorphologyToken("うち", "ウチ", WithPartOfSpeech("名詞-非自立-副詞可能"), WithBaseForm("うち")),
+				NewMorphologyToken("まるや", "マルヤ", WithPartOfSpeech("名詞-固有名詞-人名-姓"), WithBaseForm("まるや")),
+				NewMorphologyToken("ま", "マ", WithPartOfSpeech("フィラー"), WithBaseForm("ま")),
 			},
 		},
 		{
 			text: "イシウチ",
 			expected: []MorphologyToken{
-				NewMorphologyToken("イシウチ", "イシウチ"),
+				NewMorphologyToken("イシウチ", "イシウチ", WithPartOfSpeech("名詞-固有名詞-組織"), WithBaseForm("イシウチ")),
 			},
 		},
 		{
 			text: "白馬",
 			expected: []MorphologyToken{
-				NewMorphologyToken("白馬", "ハクバ"),
+				NewMorphologyToken("白馬", "ハクバ", WithPartOfSpeech("名詞-一般"), WithBaseForm("白馬")),
 			},
 		},
 		{
 			text: "白馬47",
 			expected: []MorphologyToken{
-				NewMorphologyToken("白馬", "ハクバ"),
-				NewMorphologyToken("47", "47"),
+				NewMorphologyToken("白馬", "ハクバ", WithPartOfSpeech("名詞-一般"), WithBaseForm("白馬")),
+				NewMorphologyToken("47", "47", WithPartOfSpeech("名詞-数"), WithBaseForm("47")),
 			},
 		},
 		{
 			text: "琵琶湖バレイ",
 			expected: []MorphologyToken{
-				NewMorphologyToken("琵琶湖", "ビワコ"),
-				NewMorphologyToken("バレイ", "バレイ"),
+				NewMorphologyToken("琵琶湖", "ビワコ", WithPartOfSpeech("名詞-固有名詞-地域-一般"), WithBaseForm("琵琶湖")),
+				NewMorphologyToken("バレイ", "バレイ", WithPartOfSpeech("名詞-一般"), WithBaseForm("馬齢")),
 			},
 		},
 	}
@@ -103,3 +120,113 @@ func TestAnalyze(t *testing.T) {
 		})
 	}
 }
+
+func TestNewKagome_Options(t *testing.T) {
+	userDict := filepath.Join(t.TempDir(), "userdict.txt")
+	if err := ioutil.WriteFile(userDict, []byte("石打丸山スキー場,石打丸山 スキー場,イシウチマルヤマ スキージョウ,カスタム名詞\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		options  []KagomeOption
+		text     string
+		expected []string
+	}{
+		{
+			options:  []KagomeOption{WithDictionary(ipaDictionary), WithMode(Normal)},
+			text:     "関西国際空港へ行く",
+			expected: []string{"関西国際空港", "へ", "行く"},
+		},
+		{
+			options:  []KagomeOption{WithDictionary(ipaDictionary), WithMode(Search)},
+			text:     "関西国際空港へ行く",
+			expected: []string{"関西", "国際", "空港", "へ", "行く"},
+		},
+		{
+			options:  []KagomeOption{WithDictionary(ipaDictionary), WithMode(Extended)},
+			text:     "ステルスマーケティング",
+			expected: []string{"ス", "テ", "ル", "ス", "マーケティング"},
+		},
+		{
+			options:  []KagomeOption{WithDictionary(unidicDictionary)},
+			text:     "白馬へ滑りにいきたい",
+			expected: []string{"白馬", "へ", "滑り", "に", "いき", "たい"},
+		},
+		{
+			options:  []KagomeOption{WithDictionary(ipaDictionary)},
+			text:     "石打丸山スキー場で滑る",
+			expected: []string{"石打", "丸山", "スキー", "場", "で", "滑る"},
+		},
+		{
+			options:  []KagomeOption{WithDictionary(ipaDictionary), WithUserDictionary(userDict)},
+			text:     "石打丸山スキー場で滑る",
+			expected: []string{"石打丸山スキー場", "で", "滑る"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("text = %v, expected = %v", tt.text, tt.expected), func(t *testing.T) {
+			kagome, err := NewKagome(tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens := kagome.Analyze(tt.text)
+			terms := make([]string, len(tokens))
+			for i, token := range tokens {
+				terms[i] = token.Term
+			}
+			if diff := cmp.Diff(terms, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKagome_Analyze_UserDictionary(t *testing.T) {
+	userDict := filepath.Join(t.TempDir(), "userdict.txt")
+	if err := ioutil.WriteFile(userDict, []byte("石打丸山スキー場,石打丸山 スキー場,イシウチマルヤマ スキージョウ,カスタム名詞\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kagome, err := NewKagome(WithUserDictionary(userDict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []MorphologyToken{
+		NewMorphologyToken("石打丸山スキー場", "イシウチマルヤマスキージョウ", WithPartOfSpeech("カスタム名詞"), WithBaseForm("石打丸山スキー場")),
+	}
+	if diff := cmp.Diff(kagome.Analyze("石打丸山スキー場"), expected); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestNewKagome_InvalidUserDictionary(t *testing.T) {
+	if _, err := NewKagome(WithUserDictionary(filepath.Join(t.TempDir(), "not_found.txt"))); err == nil {
+		t.Error("NewKagome() error = nil, want error")
+	}
+}
+
+// 辞書のパッケージをインポートしなくてもNEologdを使える
+func TestNewKagome_DefaultDictionary(t *testing.T) {
+	k, err := NewKagome()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.dictionary.Name() != NEologd {
+		t.Errorf("dictionary = %v, want %v", k.dictionary.Name(), NEologd)
+	}
+}
+
+func TestLookupDictionary(t *testing.T) {
+	for _, name := range []string{IPA, UniDic, NEologd} {
+		d, err := LookupDictionary(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name() != name {
+			t.Errorf("Dictionary.Name() = %v, want %v", d.Name(), name)
+		}
+	}
+	if _, err := LookupDictionary("unknown"); !errors.Is(err, ErrDictionaryNotFound) {
+		t.Errorf("LookupDictionary() error = %v, want %v", err, ErrDictionaryNotFound)
+	}
+}
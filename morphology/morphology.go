@@ -5,13 +5,42 @@ type Morphology interface {
 }
 
 type MorphologyToken struct {
-	Term string
-	Kana string
+	Term           string
+	Kana           string
+	PartOfSpeech   string // 品詞。細分類がある時は"助詞-係助詞"のように"-"で繋げる
+	BaseForm       string // 原形
+	InflectionType string // 活用型
+	InflectionForm string // 活用形
 }
 
-func NewMorphologyToken(term, kana string) MorphologyToken {
-	return MorphologyToken{
+type MorphologyTokenOption func(*MorphologyToken)
+
+func NewMorphologyToken(term, kana string, options ...MorphologyTokenOption) MorphologyToken {
+	token := MorphologyToken{
 		Term: term,
 		Kana: kana,
 	}
+	for _, option := range options {
+		option(&token)
+	}
+	return token
+}
+
+func WithPartOfSpeech(pos string) MorphologyTokenOption {
+	return func(t *MorphologyToken) {
+		t.PartOfSpeech = pos
+	}
+}
+
+func WithBaseForm(baseForm string) MorphologyTokenOption {
+	return func(t *MorphologyToken) {
+		t.BaseForm = baseForm
+	}
+}
+
+func WithInflection(inflectionType, inflectionForm string) MorphologyTokenOption {
+	return func(t *MorphologyToken) {
+		t.InflectionType = inflectionType
+		t.InflectionForm = inflectionForm
+	}
 }
@@ -0,0 +1,14 @@
+// UniDic
+// インポートするとmorphology.UniDicの名前で登録される
+package unidic
+
+import (
+	"github.com/ikawaha/kagome-dict/uni"
+	"github.com/kotaroooo0/stalefish/morphology"
+)
+
+var Dictionary = morphology.NewDictionary(morphology.UniDic, uni.Dict)
+
+func init() {
+	morphology.RegisterDictionary(Dictionary)
+}
@@ -1,5 +1,7 @@
 package stalefish
 
+import "fmt"
+
 type MatchAllQuery struct{}
 
 func NewMatchAllQuery() MatchAllQuery {
@@ -11,6 +13,7 @@ func (q MatchAllQuery) Searcher(storage Storage) Searcher {
 }
 
 type MatchQuery struct {
+	field    string
 	keyword  string
 	logic    Logic
 	analyzer Analyzer
@@ -26,13 +29,30 @@ func NewMatchQuery(keyword string, logic Logic, analyzer Analyzer, sorter Sorter
 	}
 }
 
+// スキーマのフィールドを検索するMatchQuery
+// アナライザを指定しなければフィールドの検索時のアナライザを使う
+func NewFieldMatchQuery(schema Schema, field, keyword string, logic Logic, sorter Sorter, options ...FieldQueryOption) (MatchQuery, error) {
+	analyzer, err := queryAnalyzer(schema, field, keyword, options)
+	if err != nil {
+		return MatchQuery{}, err
+	}
+	return MatchQuery{
+		field:    field,
+		keyword:  keyword,
+		logic:    logic,
+		analyzer: analyzer,
+		sorter:   sorter,
+	}, nil
+}
+
 func (q MatchQuery) Searcher(storage Storage) Searcher {
-	tokenStream := q.analyzer.Analyze(q.keyword)
+	tokenStream := fieldTokenStream(q.field, q.analyzer.Analyze(q.keyword))
 	return NewMatchSearcher(tokenStream, q.logic, storage, q.sorter)
 
 }
 
 type PhraseQuery struct {
+	field    string
 	phrase   string
 	analyzer Analyzer
 	sorter   Sorter
@@ -46,7 +66,86 @@ func NewPhraseQuery(phrase string, analyzer Analyzer, sorter Sorter) PhraseQuery
 	}
 }
 
+// スキーマのフィールドを検索するPhraseQuery
+// アナライザを指定しなければフィールドの検索時のアナライザを使う
+func NewFieldPhraseQuery(schema Schema, field, phrase string, sorter Sorter, options ...FieldQueryOption) (PhraseQuery, error) {
+	analyzer, err := queryAnalyzer(schema, field, phrase, options)
+	if err != nil {
+		return PhraseQuery{}, err
+	}
+	return PhraseQuery{
+		field:    field,
+		phrase:   phrase,
+		analyzer: analyzer,
+		sorter:   sorter,
+	}, nil
+}
+
 func (q PhraseQuery) Searcher(storage Storage) Searcher {
-	terms := q.analyzer.Analyze(q.phrase)
+	terms := fieldTokenStream(q.field, q.analyzer.Analyze(q.phrase))
 	return NewPhraseSearcher(terms, storage, q.sorter)
 }
+
+// 表記、ひらがなの読み、ローマ字の読みのフィールドをそれぞれフレーズとして検索するクエリ
+// 表記で一致したドキュメント、ひらがなの読みで一致したドキュメント、ローマ字の読みで一致したドキュメントの順に並べる
+// スキーマはNewReadingSchemaで作ったものを使う
+type ReadingQuery struct {
+	queries []PhraseQuery
+}
+
+func NewReadingQuery(schema Schema, keyword string, sorter Sorter) (ReadingQuery, error) {
+	fields := []string{BodyField, KanaReadingField, RomajiReadingField}
+	queries := make([]PhraseQuery, len(fields))
+	for i, field := range fields {
+		q, err := NewFieldPhraseQuery(schema, field, keyword, sorter)
+		if err != nil {
+			return ReadingQuery{}, err
+		}
+		queries[i] = q
+	}
+	return ReadingQuery{
+		queries: queries,
+	}, nil
+}
+
+func (q ReadingQuery) Searcher(storage Storage) Searcher {
+	searchers := make([]Searcher, len(q.queries))
+	for i, query := range q.queries {
+		searchers[i] = query.Searcher(storage)
+	}
+	return NewPrioritySearcher(searchers...)
+}
+
+type fieldQuery struct {
+	analyzer *Analyzer
+}
+
+type FieldQueryOption func(*fieldQuery)
+
+// フィールドの検索時のアナライザの代わりに使うアナライザ
+func WithQueryAnalyzer(analyzer Analyzer) FieldQueryOption {
+	return func(q *fieldQuery) {
+		q.analyzer = &analyzer
+	}
+}
+
+// フィールドを検索するアナライザを返す
+// アナライザが出力する語句がフィールドのインデックス中の語句と一致し得なければエラーを返す
+func queryAnalyzer(schema Schema, field, text string, options []FieldQueryOption) (Analyzer, error) {
+	f, ok := schema.Field(field)
+	if !ok {
+		return Analyzer{}, fmt.Errorf("%w: %q", ErrUnknownField, field)
+	}
+	q := fieldQuery{}
+	for _, option := range options {
+		option(&q)
+	}
+	analyzer := f.SearchAnalyzer
+	if q.analyzer != nil {
+		analyzer = *q.analyzer
+	}
+	if err := validateQueryTerms(f, text, analyzer.Analyze(text)); err != nil {
+		return Analyzer{}, err
+	}
+	return analyzer, nil
+}
@@ -0,0 +1,179 @@
+package stalefish
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrReadOnlyStorage = errors.New("index reader is read-only")
+
+// ストレージ上の転置インデックスとインデクサのメモリ上の転置インデックスをまとめて検索するためのリーダー
+// 生成またはRefreshを呼んだ時点のインデックスが検索対象になり、それ以降に追加したドキュメントはポスティングリストにもドキュメントの取得にも現れない
+// Storageを満たすので、そのままQueryのSearcherに渡せる
+type IndexReader struct {
+	mu              sync.RWMutex
+	indexer         *Indexer
+	storage         Storage           // 永続化層
+	buffered        InvertedIndex     // Refresh時点でのメモリ上の転置インデックスのスナップショット
+	checkpoint      indexerCheckpoint // Refresh時点でのインデクサのドキュメントの追加状況
+	refreshInterval time.Duration     // 定期的にRefreshする間隔(0なら無効)
+	done            chan struct{}
+	wg              sync.WaitGroup
+}
+
+type IndexReaderOption func(*IndexReader)
+
+// dごとにRefreshし、追加されたドキュメントが遅くともdで検索可能になるようにする
+func WithRefreshInterval(d time.Duration) IndexReaderOption {
+	return func(r *IndexReader) {
+		r.refreshInterval = d
+	}
+}
+
+func NewIndexReader(indexer *Indexer, options ...IndexReaderOption) *IndexReader {
+	buffered, checkpoint := indexer.snapshot()
+	reader := &IndexReader{
+		indexer:    indexer,
+		storage:    indexer.storage,
+		buffered:   buffered,
+		checkpoint: checkpoint,
+		done:       make(chan struct{}),
+	}
+	for _, option := range options {
+		option(reader)
+	}
+	if reader.refreshInterval > 0 {
+		reader.wg.Add(1)
+		go reader.refreshPeriodically()
+	}
+	return reader
+}
+
+// インデクサのメモリ上の転置インデックスのスナップショットを取り直し、検索可能にする
+func (r *IndexReader) Refresh() {
+	buffered, checkpoint := r.indexer.snapshot()
+	r.mu.Lock()
+	r.buffered, r.checkpoint = buffered, checkpoint
+	r.mu.Unlock()
+}
+
+func (r *IndexReader) refreshPeriodically() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.Refresh()
+		}
+	}
+}
+
+// 定期的なRefreshを停止する
+func (r *IndexReader) Close() {
+	select {
+	case <-r.done:
+		return
+	default:
+		close(r.done)
+	}
+	r.wg.Wait()
+}
+
+func (r *IndexReader) CountDocuments() (int, error) {
+	return r.indexer.countDocumentsAt(r.currentCheckpoint())
+}
+
+func (r *IndexReader) GetAllDocuments() ([]Document, error) {
+	docs, err := r.storage.GetAllDocuments()
+	if err != nil {
+		return nil, err
+	}
+	return r.visibleDocuments(docs), nil
+}
+
+func (r *IndexReader) GetDocuments(ids []DocumentID) ([]Document, error) {
+	docs, err := r.storage.GetDocuments(ids)
+	if err != nil {
+		return nil, err
+	}
+	return r.visibleDocuments(docs), nil
+}
+
+func (r *IndexReader) currentCheckpoint() indexerCheckpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkpoint
+}
+
+// Refresh以降に追加したドキュメントを取り除く
+// ストレージから読んだ後に呼ぶことで、読んでいる間に追加されたドキュメントも取り除ける
+func (r *IndexReader) visibleDocuments(docs []Document) []Document {
+	since, ok := r.indexer.addedSince(r.currentCheckpoint())
+	if !ok {
+		return docs
+	}
+	visible := make([]Document, 0, len(docs))
+	for _, doc := range docs {
+		if doc.ID < since {
+			visible = append(visible, doc)
+		}
+	}
+	return visible
+}
+
+func (r *IndexReader) GetTokenByTerm(term string) (*Token, error) {
+	return r.storage.GetTokenByTerm(term)
+}
+
+func (r *IndexReader) GetTokensByTerms(terms []string) ([]Token, error) {
+	return r.storage.GetTokensByTerms(terms)
+}
+
+func (r *IndexReader) GetAllTokens() ([]Token, error) {
+	return r.storage.GetAllTokens()
+}
+
+// ストレージ上の転置インデックスにスナップショットの転置インデックスをマージして返す
+func (r *IndexReader) GetInvertedIndexByTokenIDs(ids []TokenID) (InvertedIndex, error) {
+	inverted, err := r.storage.GetInvertedIndexByTokenIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh以降にストレージへマージされたドキュメントのポスティングは取り除く
+	since, filter := r.indexer.addedSince(r.currentCheckpoint())
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	merged := make(InvertedIndex, len(ids))
+	for _, id := range ids {
+		stored, ok := inverted[id]
+		if ok && filter {
+			stored = stored.before(since)
+			ok = stored.Postings != nil
+		}
+		buffered, bok := r.buffered[id]
+		if !ok && !bok {
+			continue
+		}
+		// mergeは引数を変更しないので、スナップショットを他の検索と共有していても安全
+		merged[id] = merge(buffered, stored)
+	}
+	return merged, nil
+}
+
+func (r *IndexReader) AddDocument(Document) (DocumentID, error) {
+	return 0, ErrReadOnlyStorage
+}
+
+func (r *IndexReader) AddToken(Token) (TokenID, error) {
+	return 0, ErrReadOnlyStorage
+}
+
+func (r *IndexReader) UpsertInvertedIndex(InvertedIndex) error {
+	return ErrReadOnlyStorage
+}
@@ -0,0 +1,122 @@
+package stalefish
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIndexReader_Refresh(t *testing.T) {
+	// Mock
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStorage := NewMockStorage(mockCtrl)
+
+	// Given: ストレージにはドキュメント1のみマージ済み
+	doc1 := Document{ID: 1, Body: "aa", TokenCount: 1}
+	doc2 := Document{ID: 2, Body: "bb aa", TokenCount: 2}
+	mockStorage.EXPECT().AddDocument(gomock.Any()).Return(doc2.ID, nil)
+	mockStorage.EXPECT().GetTokenByTerm("aa").Return(&Token{ID: 1, Term: "aa"}, nil).AnyTimes()
+	mockStorage.EXPECT().GetTokenByTerm("bb").Return(&Token{ID: 2, Term: "bb"}, nil).AnyTimes()
+	mockStorage.EXPECT().GetTokensByTerms([]string{"aa"}).Return([]Token{{ID: 1, Term: "aa"}}, nil).AnyTimes()
+	mockStorage.EXPECT().GetInvertedIndexByTokenIDs([]TokenID{1}).DoAndReturn(func([]TokenID) (InvertedIndex, error) {
+		return InvertedIndex{1: NewPostingList(NewPostings(1, []uint64{0}, nil))}, nil
+	}).AnyTimes()
+	mockStorage.EXPECT().GetDocuments([]DocumentID{1}).Return([]Document{doc1}, nil)
+	mockStorage.EXPECT().GetDocuments([]DocumentID{1, 2}).Return([]Document{doc1, doc2}, nil).Times(2)
+
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	indexer := NewIndexer(mockStorage, analyzer, 100)
+	reader := NewIndexReader(indexer)
+	defer reader.Close()
+	if err := indexer.AddDocument(NewDocument(doc2.Body)); err != nil {
+		t.Fatal(err)
+	}
+	query := NewMatchQuery("aa", OR, analyzer, nil)
+
+	// When: Refresh前
+	docs, err := query.Searcher(reader).Search()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then: メモリ上のドキュメントは見えない
+	if diff := cmp.Diff(docs, []Document{doc1}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+
+	// When: Refresh後
+	reader.Refresh()
+
+	// Then: メモリ上のドキュメントも検索できる
+	// スナップショットが破壊されていないことを確認するため二度検索する
+	for i := 0; i < 2; i++ {
+		docs, err = query.Searcher(reader).Search()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(docs, []Document{doc1, doc2}); diff != "" {
+			t.Errorf("Diff: (-got +want)\n%s", diff)
+		}
+	}
+}
+
+func TestIndexReader_ReadOnly(t *testing.T) {
+	reader := NewIndexReader(NewIndexer(nil, Analyzer{}, 1))
+	defer reader.Close()
+	if _, err := reader.AddDocument(NewDocument("aa")); err != ErrReadOnlyStorage {
+		t.Errorf("IndexReader.AddDocument() = %v, want %v", err, ErrReadOnlyStorage)
+	}
+	if err := reader.UpsertInvertedIndex(InvertedIndex{}); err != ErrReadOnlyStorage {
+		t.Errorf("IndexReader.UpsertInvertedIndex() = %v, want %v", err, ErrReadOnlyStorage)
+	}
+}
+
+func TestIndexReader_PointInTime(t *testing.T) {
+	storage := newMemoryStorage()
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	indexer := NewIndexer(storage, analyzer, 1)
+	if err := indexer.AddDocument(NewDocument("aa")); err != nil {
+		t.Fatal(err)
+	}
+	reader := NewIndexReader(indexer)
+	defer reader.Close()
+
+	// Given: 生成後に追加し、ストレージへマージ済みのドキュメント
+	if err := indexer.AddDocument(NewDocument("aa bb")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then: Refreshするまでは、どの検索でも生成時点のドキュメントだけが見える
+	assertVisible := func(want []Document) {
+		t.Helper()
+		all, err := NewMatchAllQuery().Searcher(reader).Search()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(all, want); diff != "" {
+			t.Errorf("MatchAllQuery Diff: (-got +want)\n%s", diff)
+		}
+		matched, err := NewMatchQuery("aa", OR, analyzer, nil).Searcher(reader).Search()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(matched, want); diff != "" {
+			t.Errorf("MatchQuery Diff: (-got +want)\n%s", diff)
+		}
+		count, err := reader.CountDocuments()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(want) {
+			t.Errorf("IndexReader.CountDocuments() = %v, want %v", count, len(want))
+		}
+	}
+	doc1 := Document{ID: 1, Body: "aa", TokenCount: 1}
+	doc2 := Document{ID: 2, Body: "aa bb", TokenCount: 2}
+	assertVisible([]Document{doc1})
+
+	reader.Refresh()
+	assertVisible([]Document{doc1, doc2})
+}
@@ -0,0 +1,199 @@
+package stalefish
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kotaroooo0/stalefish/morphology"
+)
+
+var (
+	ErrInvalidSchema         = errors.New("invalid schema")
+	ErrUnknownField          = errors.New("unknown field")
+	ErrQueryAnalyzerMismatch = errors.New("query analyzer produces terms that never match")
+)
+
+// 本文のフィールド名
+const BodyField = "body"
+
+// フィールド
+// ドキュメントのフィールドは本文だけなので、全てのフィールドは本文を別々のアナライザで解析したものになる
+// 本文以外のフィールドの語句は"フィールド名:語句"としてインデックスする
+type Field struct {
+	Name           string
+	IndexAnalyzer  Analyzer // インデックス時のアナライザ
+	SearchAnalyzer Analyzer // 検索時のアナライザ
+}
+
+func NewField(name string, indexAnalyzer, searchAnalyzer Analyzer) Field {
+	return Field{
+		Name:           name,
+		IndexAnalyzer:  indexAnalyzer,
+		SearchAnalyzer: searchAnalyzer,
+	}
+}
+
+// インデックスのスキーマ
+// Indexerはスキーマの全てのフィールドをインデックスし、クエリはフィールドの検索時のアナライザを使う
+type Schema struct {
+	fields []Field
+}
+
+// 本文のフィールドは必須で、フィールド名は重複できない
+func NewSchema(fields ...Field) (Schema, error) {
+	names := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		if f.Name == "" || strings.Contains(f.Name, ":") {
+			return Schema{}, fmt.Errorf("%w: invalid field name %q", ErrInvalidSchema, f.Name)
+		}
+		if _, ok := names[f.Name]; ok {
+			return Schema{}, fmt.Errorf("%w: duplicate field %q", ErrInvalidSchema, f.Name)
+		}
+		names[f.Name] = struct{}{}
+	}
+	if _, ok := names[BodyField]; !ok {
+		return Schema{}, fmt.Errorf("%w: field %q is required", ErrInvalidSchema, BodyField)
+	}
+	return Schema{fields: fields}, nil
+}
+
+// インデックス時と検索時に同じアナライザを使う本文のフィールドだけのスキーマ
+func newBodySchema(analyzer Analyzer) Schema {
+	return Schema{fields: []Field{NewField(BodyField, analyzer, analyzer)}}
+}
+
+func (s Schema) Fields() []Field {
+	fields := make([]Field, len(s.fields))
+	copy(fields, s.fields)
+	return fields
+}
+
+func (s Schema) Field(name string) (Field, bool) {
+	for _, f := range s.fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// 本文を全てのフィールドのインデックス時のアナライザで解析し、ドキュメント中の語句ごとの位置を返す
+// 語句はフィールド名を付けたもので、本文のフィールドのトークン数も返す
+// トークンはスライスにせず、1つずつ読みながら語句の位置に追加して他の属性を捨てる
+// 位置の長さは保存しないので、シノニム等で重なったトークンのグラフは平坦化してからインデックスする
+func (s Schema) analyze(body string) (documentPostings, int) {
+	postings := newDocumentPostings()
+	count := 0
+	for _, f := range s.fields {
+		n := 0
+		var position uint64
+		it := newFlattenGraphTokenIterator(f.IndexAnalyzer.AnalyzeIterator(body))
+		for it.Next() {
+			t := it.Token()
+			// TokenStream.Positionsと同じく、先頭のトークンの位置は位置の増分から1を引いた位置にする
+			if n > 0 {
+				position += uint64(t.PositionIncrement)
+			} else if t.PositionIncrement > 1 {
+				position = uint64(t.PositionIncrement - 1)
+			}
+			postings.add(fieldTerm(f.Name, t.Term), position)
+			n++
+		}
+		if f.Name == BodyField {
+			count = n
+		}
+	}
+	return postings, count
+}
+
+// ドキュメント中の語句ごとの位置
+// 語句は最初に現れた順に並べる
+type documentPostings struct {
+	terms     []string
+	positions map[string][]uint64
+}
+
+func newDocumentPostings() documentPostings {
+	return documentPostings{
+		terms:     make([]string, 0),
+		positions: make(map[string][]uint64),
+	}
+}
+
+func (p *documentPostings) add(term string, position uint64) {
+	if _, ok := p.positions[term]; !ok {
+		p.terms = append(p.terms, term)
+	}
+	p.positions[term] = append(p.positions[term], position)
+}
+
+// フィールドの語句をインデックス中の語句にする
+// 本文のフィールドの語句はそのまま使う
+func fieldTerm(field, term string) string {
+	if field == "" || field == BodyField {
+		return term
+	}
+	return field + ":" + term
+}
+
+func fieldTokenStream(field string, tokenStream TokenStream) TokenStream {
+	if field == "" || field == BodyField {
+		return tokenStream
+	}
+	tokens := make([]Token, tokenStream.Size())
+	for i, t := range tokenStream.Tokens {
+		t.Term = fieldTerm(field, t.Term)
+		tokens[i] = t
+	}
+	return NewTokenStream(tokens)
+}
+
+// 検索時のアナライザが、インデックス時のアナライザが出力しない語句を出力していればエラーを返す
+// 語句は同じ文字列をインデックス時のアナライザで解析した結果に含まれれば一致し得るとみなす
+// 含まれなくても、検索時だけに追加するシノニム等のために語句自身をインデックス時のアナライザで解析して含まれれば一致し得るとみなす
+// 語幹の抽出や形態素解析は語句を再び解析すると別の語句になることがあるので、語句自身の解析だけでは判定しない
+func validateQueryTerms(field Field, text string, tokenStream TokenStream) error {
+	indexed := field.IndexAnalyzer.Analyze(text)
+	unmatchable := make([]string, 0)
+	for _, term := range tokenStream.Terms() {
+		if containsTerm(indexed, term) || containsTerm(field.IndexAnalyzer.Analyze(term), term) {
+			continue
+		}
+		unmatchable = append(unmatchable, term)
+	}
+	if len(unmatchable) > 0 {
+		return fmt.Errorf("%w: field %q: %q", ErrQueryAnalyzerMismatch, field.Name, unmatchable)
+	}
+	return nil
+}
+
+func containsTerm(tokenStream TokenStream, term string) bool {
+	for _, t := range tokenStream.Tokens {
+		if t.Term == term {
+			return true
+		}
+	}
+	return false
+}
+
+// 読みのフィールド名
+const (
+	KanaReadingField   = BodyField + ".kana"
+	RomajiReadingField = BodyField + ".romaji"
+)
+
+// 本文の表記に加えて、ひらがなとローマ字の読みをフィールドとしてインデックスするスキーマ
+// 読みのフィールドは読みを2文字ずつのN-gramにするので、"hakuba"や"はくば"で"白馬"を検索できる
+// ReadingQueryで全てのフィールドを検索する
+func NewReadingSchema(morphology morphology.Morphology) Schema {
+	charFilters := []CharFilter{NewNormalizationCharFilter(NFKCCasefold)}
+	surface := NewAnalyzer(charFilters, NewMorphologicalTokenizer(morphology), []TokenFilter{})
+	kana := NewAnalyzer(charFilters, NewReadingNgramTokenizer(morphology, ReadingFormKana, 2), []TokenFilter{})
+	romaji := NewAnalyzer(charFilters, NewReadingNgramTokenizer(morphology, ReadingFormRomaji, 2), []TokenFilter{})
+	return Schema{fields: []Field{
+		NewField(BodyField, surface, surface),
+		NewField(KanaReadingField, kana, kana),
+		NewField(RomajiReadingField, romaji, romaji),
+	}}
+}
@@ -0,0 +1,288 @@
+package stalefish
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"unicode"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kotaroooo0/stalefish/morphology"
+)
+
+func TestNewSchema(t *testing.T) {
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	cases := []struct {
+		fields   []Field
+		expected error
+	}{
+		{fields: []Field{NewField(BodyField, analyzer, analyzer)}, expected: nil},
+		{fields: []Field{NewField(BodyField, analyzer, analyzer), NewField("body.ngram", analyzer, analyzer)}, expected: nil},
+		{fields: []Field{}, expected: ErrInvalidSchema},
+		{fields: []Field{NewField("title", analyzer, analyzer)}, expected: ErrInvalidSchema},
+		{fields: []Field{NewField(BodyField, analyzer, analyzer), NewField(BodyField, analyzer, analyzer)}, expected: ErrInvalidSchema},
+		{fields: []Field{NewField(BodyField, analyzer, analyzer), NewField("", analyzer, analyzer)}, expected: ErrInvalidSchema},
+		{fields: []Field{NewField(BodyField, analyzer, analyzer), NewField("a:b", analyzer, analyzer)}, expected: ErrInvalidSchema},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("fields = %v, expected = %v", len(tt.fields), tt.expected), func(t *testing.T) {
+			if _, err := NewSchema(tt.fields...); !errors.Is(err, tt.expected) {
+				t.Errorf("NewSchema() error = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSchema_Analyze(t *testing.T) {
+	schema, err := NewSchema(
+		NewField(BodyField, NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewStopWordFilter([]string{"the"})}), Analyzer{}),
+		NewField("raw", NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{}), Analyzer{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postings, count := schema.analyze("The fox and the Fox")
+
+	want := documentPostings{
+		terms: []string{"fox", "and", "raw:The", "raw:fox", "raw:and", "raw:the", "raw:Fox"},
+		positions: map[string][]uint64{
+			"fox": {1, 4}, "and": {2},
+			"raw:The": {0}, "raw:fox": {1}, "raw:and": {2}, "raw:the": {3}, "raw:Fox": {4},
+		},
+	}
+	if diff := cmp.Diff(postings, want, cmp.AllowUnexported(documentPostings{})); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if count != 3 {
+		t.Errorf("count = %v, want 3", count)
+	}
+}
+
+func TestFieldQuery(t *testing.T) {
+	standard := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()})
+	edgeNgram := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewEdgeNgramFilter(1, 10, EdgeNgramFront)})
+	schema, err := NewSchema(
+		NewField(BodyField, standard, standard),
+		NewField("body.prefix", edgeNgram, standard),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := newMemoryStorage()
+	indexer := NewIndexerWithSchema(storage, schema, 1)
+	for _, body := range []string{"MacBook Pro", "Magic Mouse", "Pro Display"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		field    string
+		keyword  string
+		phrase   bool
+		expected []string
+	}{
+		{field: BodyField, keyword: "pro", expected: []string{"MacBook Pro", "Pro Display"}},
+		{field: BodyField, keyword: "ma", expected: []string{}},
+		{field: "body.prefix", keyword: "ma", expected: []string{"MacBook Pro", "Magic Mouse"}},
+		{field: "body.prefix", keyword: "mag mo", expected: []string{"Magic Mouse"}},
+		{field: "body.prefix", keyword: "pro d", phrase: true, expected: []string{"Pro Display"}},
+		{field: BodyField, keyword: "magic mouse", phrase: true, expected: []string{"Magic Mouse"}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("field = %v, keyword = %v, phrase = %v, expected = %v", tt.field, tt.keyword, tt.phrase, tt.expected), func(t *testing.T) {
+			var searcher Searcher
+			if tt.phrase {
+				q, err := NewFieldPhraseQuery(indexer.Schema(), tt.field, tt.keyword, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				searcher = q.Searcher(storage)
+			} else {
+				q, err := NewFieldMatchQuery(indexer.Schema(), tt.field, tt.keyword, AND, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				searcher = q.Searcher(storage)
+			}
+			docs, err := searcher.Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFieldQuery_Error(t *testing.T) {
+	lowercase := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewStopWordFilter([]string{"the"})})
+	schema, err := NewSchema(NewField(BodyField, lowercase, lowercase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	standard := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	cases := []struct {
+		field    string
+		keyword  string
+		options  []FieldQueryOption
+		expected error
+	}{
+		{field: BodyField, keyword: "The Go", expected: nil},
+		{field: BodyField, keyword: "go", options: []FieldQueryOption{WithQueryAnalyzer(standard)}, expected: nil},
+		{field: BodyField, keyword: "Go", options: []FieldQueryOption{WithQueryAnalyzer(standard)}, expected: ErrQueryAnalyzerMismatch},
+		{field: BodyField, keyword: "the go", options: []FieldQueryOption{WithQueryAnalyzer(standard)}, expected: ErrQueryAnalyzerMismatch},
+		{field: "title", keyword: "go", expected: ErrUnknownField},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("field = %v, keyword = %v, expected = %v", tt.field, tt.keyword, tt.expected), func(t *testing.T) {
+			if _, err := NewFieldMatchQuery(schema, tt.field, tt.keyword, OR, nil, tt.options...); !errors.Is(err, tt.expected) {
+				t.Errorf("NewFieldMatchQuery() error = %v, want %v", err, tt.expected)
+			}
+			if _, err := NewFieldPhraseQuery(schema, tt.field, tt.keyword, nil, tt.options...); !errors.Is(err, tt.expected) {
+				t.Errorf("NewFieldPhraseQuery() error = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFieldQuery_IndexAnalyzerNotIdempotent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMorphology := NewMockMorphology(mockCtrl)
+	// 活用する語句の原形は、単独で解析すると別の語句に分割される
+	mockMorphology.EXPECT().Analyze(gomock.Any()).DoAndReturn(func(s string) []morphology.MorphologyToken {
+		return map[string][]morphology.MorphologyToken{
+			"いきたい": {
+				morphology.NewMorphologyToken("いき", "イキ", morphology.WithBaseForm("いく"), morphology.WithInflection("五段・カ行促音便", "連用形")),
+				morphology.NewMorphologyToken("たい", "タイ", morphology.WithBaseForm("たい"), morphology.WithInflection("特殊・タイ", "基本形")),
+			},
+			"いく": {
+				morphology.NewMorphologyToken("い", "イ", morphology.WithBaseForm("いる"), morphology.WithInflection("一段", "連用形")),
+				morphology.NewMorphologyToken("く", "ク", morphology.WithBaseForm("く")),
+			},
+		}[s]
+	}).AnyTimes()
+	morphological := NewAnalyzer([]CharFilter{}, NewMorphologicalTokenizer(mockMorphology), []TokenFilter{NewJapaneseBaseFormFilter()})
+	// "universities"の語幹"univers"の語幹は"univ"になる
+	stemmed := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewStemmerFilter()})
+	schema, err := NewSchema(NewField(BodyField, stemmed, stemmed), NewField("body.ja", morphological, morphological))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		field   string
+		keyword string
+	}{
+		{field: BodyField, keyword: "Universities"},
+		{field: "body.ja", keyword: "いきたい"},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("field = %v, keyword = %v", tt.field, tt.keyword), func(t *testing.T) {
+			if _, err := NewFieldMatchQuery(schema, tt.field, tt.keyword, OR, nil); err != nil {
+				t.Errorf("NewFieldMatchQuery() error = %v, want nil", err)
+			}
+			if _, err := NewFieldPhraseQuery(schema, tt.field, tt.keyword, nil); err != nil {
+				t.Errorf("NewFieldPhraseQuery() error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestReadingQuery(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMorphology := NewMockMorphology(mockCtrl)
+	mockMorphology.EXPECT().Analyze(gomock.Any()).DoAndReturn(fakeAnalyze(map[string]string{
+		"白馬":  "ハクバ",
+		"村":   "ムラ",
+		"の":   "ノ",
+		"スキー": "スキー",
+		"場":   "ジョウ",
+		"ホテル": "ホテル",
+		"東京":  "トウキョウ",
+	})).AnyTimes()
+
+	storage := newMemoryStorage()
+	indexer := NewIndexerWithSchema(storage, NewReadingSchema(mockMorphology), 1)
+	for _, body := range []string{"はくばのホテル", "白馬村のスキー場", "Hakuba Valley", "東京のホテル"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		keyword  string
+		expected []string
+	}{
+		{keyword: "白馬", expected: []string{"白馬村のスキー場", "はくばのホテル", "Hakuba Valley"}},
+		{keyword: "はくば", expected: []string{"はくばのホテル", "白馬村のスキー場", "Hakuba Valley"}},
+		{keyword: "ハクバ", expected: []string{"はくばのホテル", "白馬村のスキー場", "Hakuba Valley"}},
+		{keyword: "hakuba", expected: []string{"Hakuba Valley", "はくばのホテル", "白馬村のスキー場"}},
+		{keyword: "HAKUBA", expected: []string{"Hakuba Valley", "はくばのホテル", "白馬村のスキー場"}},
+		{keyword: "とうきょう", expected: []string{"東京のホテル"}},
+		{keyword: "大阪", expected: []string{}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("keyword = %v, expected = %v", tt.keyword, tt.expected), func(t *testing.T) {
+			q, err := NewReadingQuery(indexer.Schema(), tt.keyword, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			docs, err := q.Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+// 辞書の語を最長一致で形態素にするテスト用の形態素解析
+// 辞書にない文字は、英字の連続を1つの形態素、それ以外を1文字ずつの形態素とし、空白は捨てる
+func fakeAnalyze(dictionary map[string]string) func(string) []morphology.MorphologyToken {
+	return func(s string) []morphology.MorphologyToken {
+		tokens := make([]morphology.MorphologyToken, 0)
+		runes := []rune(s)
+		for i := 0; i < len(runes); {
+			if unicode.IsSpace(runes[i]) {
+				i++
+				continue
+			}
+			matched := false
+			for j := len(runes); j > i; j-- {
+				if kana, ok := dictionary[string(runes[i:j])]; ok {
+					tokens = append(tokens, morphology.NewMorphologyToken(string(runes[i:j]), kana))
+					i, matched = j, true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+			j := i + 1
+			for unicode.Is(unicode.Latin, runes[i]) && j < len(runes) && unicode.Is(unicode.Latin, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, morphology.NewMorphologyToken(string(runes[i:j]), ""))
+			i = j
+		}
+		return tokens
+	}
+}
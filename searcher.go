@@ -62,8 +62,12 @@ func (ms MatchSearcher) Search() ([]Document, error) {
 		return []Document{}, nil
 	}
 
-	// AND検索で対応するトークンが全て存在していなかったら、マッチするドキュメントなしでリターン
-	if ms.logic == AND && len(tokens) != len(ms.tokenStream.Terms()) {
+	tokenIDByTerm := make(map[string]TokenID, len(tokens))
+	for _, t := range tokens {
+		tokenIDByTerm[t.Term] = t.ID
+	}
+	// AND検索で存在するトークンが一つもない位置があるなら、マッチするドキュメントなしでリターン
+	if ms.logic == AND && !coversAllPositions(ms.tokenStream, tokenIDByTerm) {
 		return []Document{}, nil
 	}
 
@@ -73,17 +77,17 @@ func (ms MatchSearcher) Search() ([]Document, error) {
 		return nil, err
 	}
 
-	// ポスティングリストを抽出
-	postings := make([]*Postings, len(inverted))
-	for i, t := range tokens {
-		postings[i] = inverted[t.ID].Postings
-	}
-
 	// ポスティングリストを走査しマッチするドキュメントIDを取得
+	// AND検索はシノニム等でトークンが重なっている時、各位置に重なったトークンのいずれかを全ての位置で含むドキュメントを探す
 	var matchedIds []DocumentID
 	if ms.logic == AND {
-		matchedIds = andMatch(postings)
+		matchedIds = positionMatch(ms.tokenStream, tokenIDByTerm, inverted)
 	} else if ms.logic == OR {
+		// ポスティングリストを抽出
+		postings := make([]*Postings, len(tokens))
+		for i, t := range tokens {
+			postings[i] = inverted[t.ID].Postings
+		}
 		matchedIds = orMatch(postings)
 	}
 
@@ -100,6 +104,110 @@ func (ms MatchSearcher) Search() ([]Document, error) {
 	return ms.sorter.Sort(documents, inverted, tokens)
 }
 
+// 各位置について、その位置にまたがるトークンのいずれかを含むドキュメントを探し、全ての位置で見つかったドキュメントのIDを返す
+// 重なったトークンの経路を列挙しないので、経路の数が多いシングルやエッジN-gramでもトークン数に比例した回数だけポスティングリストを走査する
+func positionMatch(tokenStream TokenStream, tokenIDByTerm map[string]TokenID, inverted InvertedIndex) []DocumentID {
+	// トークンが一つだけの位置はまとめてAND検索し、複数のトークンが重なる位置はOR検索した結果と積を取る
+	singles := make([]*Postings, 0)
+	seen := make(map[TokenID]struct{})
+	var alternatives [][]*Postings
+	for _, group := range positionGroups(tokenStream) {
+		postings := make([]*Postings, 0, len(group))
+		ids := make(map[TokenID]struct{}, len(group))
+		for _, i := range group {
+			id, ok := tokenIDByTerm[tokenStream.Tokens[i].Term]
+			if _, dup := ids[id]; !ok || dup {
+				continue
+			}
+			ids[id] = struct{}{}
+			postings = append(postings, inverted[id].Postings)
+		}
+		if len(postings) == 0 {
+			return []DocumentID{}
+		}
+		if len(postings) > 1 {
+			alternatives = append(alternatives, postings)
+			continue
+		}
+		for id := range ids {
+			if _, ok := seen[id]; !ok {
+				seen[id] = struct{}{}
+				singles = append(singles, postings[0])
+			}
+		}
+	}
+
+	var matched []DocumentID
+	if len(singles) > 0 {
+		matched = andMatch(singles)
+	}
+	for i, postings := range alternatives {
+		if i == 0 && len(singles) == 0 {
+			matched = orMatch(postings)
+			continue
+		}
+		matched = intersectDocumentIDs(matched, orMatch(postings))
+	}
+	return matched
+}
+
+// トークンの位置ごとに、その位置にまたがるトークンのインデックスを位置の順に返す
+// どのトークンもまたがらない空いた位置は含まない
+func positionGroups(tokenStream TokenStream) [][]int {
+	positions := tokenStream.Positions()
+	groups := make(map[uint64][]int)
+	keys := make([]uint64, 0)
+	for i, t := range tokenStream.Tokens {
+		for p := positions[i]; p < positions[i]+uint64(positionLength(t)); p++ {
+			if _, ok := groups[p]; !ok {
+				keys = append(keys, p)
+			}
+			groups[p] = append(groups[p], i)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	r := make([][]int, len(keys))
+	for i, k := range keys {
+		r[i] = groups[k]
+	}
+	return r
+}
+
+// 全ての位置に、ストレージに存在するトークンが一つ以上あるかどうか
+func coversAllPositions(tokenStream TokenStream, tokenIDByTerm map[string]TokenID) bool {
+	for _, group := range positionGroups(tokenStream) {
+		found := false
+		for _, i := range group {
+			if _, ok := tokenIDByTerm[tokenStream.Tokens[i].Term]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// 昇順のドキュメントIDのスライスの共通部分
+func intersectDocumentIDs(a, b []DocumentID) []DocumentID {
+	r := []DocumentID{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			r = append(r, a[i])
+			i++
+			j++
+		}
+	}
+	return r
+}
+
 func tokenIDs(tokens []Token) []TokenID {
 	ids := make([]TokenID, len(tokens))
 	for i, t := range tokens {
@@ -200,6 +308,37 @@ func uniqueDocumentId(ids []DocumentID) []DocumentID {
 	return uniq
 }
 
+// 複数のSearcherの結果を順に繋げ、先のSearcherで見つかったドキュメントほど上位にする
+// 複数のSearcherで見つかったドキュメントは最初の位置にだけ置く
+type PrioritySearcher struct {
+	searchers []Searcher
+}
+
+func NewPrioritySearcher(searchers ...Searcher) PrioritySearcher {
+	return PrioritySearcher{
+		searchers: searchers,
+	}
+}
+
+func (ps PrioritySearcher) Search() ([]Document, error) {
+	seen := make(map[DocumentID]struct{})
+	documents := []Document{}
+	for _, s := range ps.searchers {
+		docs, err := s.Search()
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if _, ok := seen[doc.ID]; ok {
+				continue
+			}
+			seen[doc.ID] = struct{}{}
+			documents = append(documents, doc)
+		}
+	}
+	return documents, nil
+}
+
 type PhraseSearcher struct {
 	tokenStream TokenStream
 	storage     Storage
@@ -225,9 +364,22 @@ func (ps PhraseSearcher) Search() ([]Document, error) {
 	if err != nil {
 		return nil, err
 	}
+	tokenIDByTerm := make(map[string]TokenID, len(tokens))
+	for _, t := range tokens {
+		tokenIDByTerm[t.Term] = t.ID
+	}
 
-	// 対応トークンが一つも存在しないなら、マッチするドキュメントなしでリターン
-	if len(tokens) != len(ps.tokenStream.Terms()) {
+	// シングルがある時は、なるべく長いシングルを並べた経路だけでフレーズを検索する
+	// 存在するトークンが一つもない位置があるなら、マッチするドキュメントなしでリターン
+	tokenStream := ps.tokenStream
+	if hasTokenType(tokenStream, TokenTypeShingle) {
+		path, ok := longestShinglePath(tokenStream, tokenIDByTerm)
+		if !ok {
+			return []Document{}, nil
+		}
+		tokenStream = path
+	}
+	if !coversAllPositions(tokenStream, tokenIDByTerm) {
 		return []Document{}, nil
 	}
 
@@ -237,28 +389,8 @@ func (ps PhraseSearcher) Search() ([]Document, error) {
 		return nil, err
 	}
 
-	// ポスティングリストを抽出
-	postings := make([]*Postings, len(inverted))
-	for i, t := range tokens {
-		postings[i] = inverted[t.ID].Postings
-	}
-
-	// ポスティングリストを走査しマッチするドキュメントIDを取得
-	var ids []DocumentID
-	for notAllNil(postings) {
-		if isSameDocumentId(postings) { // カーソルが指す全てのDocIDが等しい時
-			// フレーズが等しければ結果に追加
-			if isPhraseMatch(ps.tokenStream, postings) {
-				ids = append(ids, postings[0].DocumentID)
-			}
-			// カーソルを全て動かす
-			next(postings)
-			continue
-		}
-		// 一番小さいカーソルを動かす
-		idx := minDocumentIDIndex(postings)
-		postings[idx] = postings[idx].Next
-	}
+	// 全ての位置の語句を含むドキュメントだけで、トークンのグラフをたどってフレーズを検索する
+	ids := phraseMatch(tokenStream, tokenIDByTerm, inverted, positionMatch(tokenStream, tokenIDByTerm, inverted))
 
 	// ドキュメントIDからドキュメントを取得
 	documents, err := ps.storage.GetDocuments(ids)
@@ -273,42 +405,164 @@ func (ps PhraseSearcher) Search() ([]Document, error) {
 	return ps.sorter.Sort(documents, inverted, tokens)
 }
 
-// フレーズを含むか判定
-func isPhraseMatch(tokenStream TokenStream, postings []*Postings) bool {
-	// 相対ポジションリストを作る
-	relativePositionsList := make([][]uint64, tokenStream.Size())
-	for i := 0; i < tokenStream.Size(); i++ {
-		relativePositionsList[i] = decremenSlice(postings[i].Positions, uint64(i))
+func hasTokenType(tokenStream TokenStream, tokenType string) bool {
+	for _, t := range tokenStream.Tokens {
+		if t.Type == tokenType {
+			return true
+		}
 	}
-
-	// 共通の要素が存在すればフレーズが存在する
-	return hasCommon(relativePositionsList)
+	return false
 }
 
-// uint64スライスsの各要素をnだけデクリメント
-func decremenSlice(s []uint64, n uint64) []uint64 {
-	result := make([]uint64, len(s))
-	for i, e := range s {
-		result[i] = e - n
+// 先頭の位置にあるトークンのうち存在する最も長いトークンを選び、そのトークンの次の位置以降で最も近い位置から同様に選んだ経路を返す
+// 存在するトークンが一つもない位置があれば経路はない
+func longestShinglePath(tokenStream TokenStream, tokenIDByTerm map[string]TokenID) (TokenStream, bool) {
+	positions := tokenStream.Positions()
+	path := make([]Token, 0)
+	next, prev := positions[0], positions[0]
+	for {
+		// next以降で最も近い位置
+		found := false
+		var p uint64
+		for _, position := range positions {
+			if position >= next && (!found || position < p) {
+				p, found = position, true
+			}
+		}
+		if !found {
+			break
+		}
+		best := -1
+		for i, t := range tokenStream.Tokens {
+			if positions[i] != p {
+				continue
+			}
+			if _, ok := tokenIDByTerm[t.Term]; ok && (best < 0 || positionLength(t) > positionLength(tokenStream.Tokens[best])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return TokenStream{}, false
+		}
+		token := tokenStream.Tokens[best]
+		if len(path) > 0 {
+			token.PositionIncrement = int(p - prev)
+		}
+		// インデックスではシングルは先頭の位置だけに置かれるので、経路上のトークンの間隔は先頭の位置の差で測る
+		next, prev = p+uint64(positionLength(token)), p
+		token.PositionLength = 0
+		path = append(path, token)
 	}
-	return result
+	return NewTokenStream(path), true
 }
 
-// 複数のスライスが共通の要素を持っているか判定
-func hasCommon(ss [][]uint64) bool {
-	s0 := ss[0]
-	for _, s1 := range ss[1:] {
-		hasCommon := false
-		for _, v1 := range s0 {
-			for _, v2 := range s1 {
-				if v1 == v2 {
-					hasCommon = true
-				}
+// candidatesのドキュメントのうち、トークンのグラフの先頭から末尾までのいずれかの経路をフレーズとして含むドキュメントのIDを返す
+// 経路を列挙せずにトークンを一つずつたどり、トークンとドキュメント中の位置の組ごとに一度だけ調べる
+// 経路中の次のトークンは、直前のトークンの次の位置(空いた位置があればその分先)にある必要がある
+func phraseMatch(tokenStream TokenStream, tokenIDByTerm map[string]TokenID, inverted InvertedIndex, candidates []DocumentID) []DocumentID {
+	ids := []DocumentID{}
+	if len(candidates) == 0 {
+		return ids
+	}
+	positions := tokenStream.Positions()
+	ends := make([]uint64, tokenStream.Size())
+	for i, t := range tokenStream.Tokens {
+		ends[i] = positions[i] + uint64(positionLength(t))
+	}
+	// 位置p以降で最も近い位置から始まるトークン
+	startingFrom := func(p uint64) []int {
+		var r []int
+		for i := range tokenStream.Tokens {
+			if positions[i] < p || (len(r) > 0 && positions[i] > positions[r[0]]) {
+				continue
+			}
+			if len(r) > 0 && positions[i] < positions[r[0]] {
+				r = r[:0]
 			}
+			r = append(r, i)
 		}
-		if !hasCommon {
+		return r
+	}
+	firsts := startingFrom(positions[0])
+	nexts := make([][]int, tokenStream.Size())
+	for i := range tokenStream.Tokens {
+		nexts[i] = startingFrom(ends[i])
+	}
+
+	// 候補のドキュメントごとに、各トークンの語句が現れる位置
+	docPositions := candidatePositions(tokenStream, tokenIDByTerm, inverted, candidates)
+	type state struct {
+		token    int
+		position uint64
+	}
+	for _, id := range candidates {
+		termPositions := docPositions[id]
+		has := func(i int, position uint64) bool {
+			_, ok := termPositions[tokenIDByTerm[tokenStream.Tokens[i].Term]][position]
+			return ok
+		}
+		failed := make(map[state]struct{})
+		var reach func(i int, position uint64) bool
+		reach = func(i int, position uint64) bool {
+			if len(nexts[i]) == 0 {
+				return true
+			}
+			if _, ok := failed[state{i, position}]; ok {
+				return false
+			}
+			for _, k := range nexts[i] {
+				next := position + positions[k] - ends[i] + 1
+				if has(k, next) && reach(k, next) {
+					return true
+				}
+			}
+			failed[state{i, position}] = struct{}{}
 			return false
 		}
+		matched := false
+		for _, i := range firsts {
+			for position := range termPositions[tokenIDByTerm[tokenStream.Tokens[i].Term]] {
+				if reach(i, position) {
+					matched = true
+					break
+				}
+			}
+			if matched {
+				break
+			}
+		}
+		if matched {
+			ids = append(ids, id)
+		}
 	}
-	return true
+	return ids
+}
+
+// 候補のドキュメントについて、トークンのIDごとに語句が現れる位置の集合を返す
+func candidatePositions(tokenStream TokenStream, tokenIDByTerm map[string]TokenID, inverted InvertedIndex, candidates []DocumentID) map[DocumentID]map[TokenID]map[uint64]struct{} {
+	r := make(map[DocumentID]map[TokenID]map[uint64]struct{}, len(candidates))
+	for _, id := range candidates {
+		r[id] = make(map[TokenID]map[uint64]struct{})
+	}
+	for _, t := range tokenStream.Tokens {
+		tokenID, ok := tokenIDByTerm[t.Term]
+		if !ok {
+			continue
+		}
+		for p := inverted[tokenID].Postings; p != nil; p = p.Next {
+			termPositions, ok := r[p.DocumentID]
+			if !ok {
+				continue
+			}
+			if _, ok := termPositions[tokenID]; ok {
+				continue
+			}
+			set := make(map[uint64]struct{}, len(p.Positions))
+			for _, position := range p.Positions {
+				set[position] = struct{}{}
+			}
+			termPositions[tokenID] = set
+		}
+	}
+	return r
 }
@@ -2,6 +2,8 @@ package stalefish
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -290,3 +292,237 @@ func TestPhraseSearch(t *testing.T) {
 		})
 	}
 }
+
+func TestPhraseSearch_PositionIncrement(t *testing.T) {
+	storage := newMemoryStorage()
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewStopWordFilter([]string{"the", "a"})})
+	indexer := NewIndexer(storage, analyzer, 1)
+	if err := indexer.AddDocument(NewDocument("quick the fox")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		phrase   string
+		expected int
+	}{
+		{phrase: "quick a fox", expected: 1},
+		{phrase: "quick fox", expected: 0},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("phrase = %v, expected = %v", tt.phrase, tt.expected), func(t *testing.T) {
+			docs, err := NewPhraseQuery(tt.phrase, analyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(docs) != tt.expected {
+				t.Errorf("len(docs) = %v, want %v", len(docs), tt.expected)
+			}
+		})
+	}
+}
+
+// インデックス時はエッジN-gramで接頭辞をトークンにし、検索時は入力をそのまま使う
+func TestMatchSearch_EdgeNgram(t *testing.T) {
+	storage := newMemoryStorage()
+	indexAnalyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewEdgeNgramFilter(1, 10, EdgeNgramFront)})
+	searchAnalyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()})
+	indexer := NewIndexer(storage, indexAnalyzer, 1)
+	for _, body := range []string{"MacBook Pro", "Magic Mouse", "iPhone"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		keyword  string
+		expected []string
+	}{
+		{keyword: "ma", expected: []string{"MacBook Pro", "Magic Mouse"}},
+		{keyword: "mag", expected: []string{"Magic Mouse"}},
+		{keyword: "mac p", expected: []string{"MacBook Pro"}},
+		{keyword: "phone", expected: []string{}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("keyword = %v, expected = %v", tt.keyword, tt.expected), func(t *testing.T) {
+			docs, err := NewMatchQuery(tt.keyword, AND, searchAnalyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPhraseSearch_Shingle(t *testing.T) {
+	storage := newMemoryStorage()
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewShingleFilter(2, 3, " ", true)})
+	indexer := NewIndexer(storage, analyzer, 1)
+	for _, body := range []string{"the quick brown fox jumps", "the brown quick fox", "a quick brown dog", "quick brown fox"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		phrase   string
+		expected []string
+	}{
+		{phrase: "quick brown", expected: []string{"the quick brown fox jumps", "a quick brown dog", "quick brown fox"}},
+		{phrase: "quick brown fox", expected: []string{"the quick brown fox jumps", "quick brown fox"}},
+		{phrase: "the quick brown fox jumps", expected: []string{"the quick brown fox jumps"}},
+		{phrase: "brown quick", expected: []string{"the brown quick fox"}},
+		{phrase: "fox", expected: []string{"the quick brown fox jumps", "the brown quick fox", "quick brown fox"}},
+		{phrase: "brown fox jumps high", expected: []string{}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("phrase = %v, expected = %v", tt.phrase, tt.expected), func(t *testing.T) {
+			docs, err := NewPhraseQuery(tt.phrase, analyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLongestShinglePath(t *testing.T) {
+	tokenStream := NewShingleFilter(2, 2, " ", true).Filter(NewTokenStream([]Token{NewToken("a"), NewToken("b"), NewToken("c"), NewToken("d"), NewToken("e")}))
+	cases := []struct {
+		terms    []string
+		expected []string
+		ok       bool
+	}{
+		{terms: []string{"a", "b", "c", "d", "e", "a b", "b c", "c d", "d e"}, expected: []string{"a b", "c d", "e"}, ok: true},
+		{terms: []string{"a", "b", "c", "d", "e", "b c", "d e"}, expected: []string{"a", "b c", "d e"}, ok: true},
+		{terms: []string{"a", "b", "c", "d", "e"}, expected: []string{"a", "b", "c", "d", "e"}, ok: true},
+		{terms: []string{"a b", "c d"}, ok: false},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("terms = %v, expected = %v, ok = %v", tt.terms, tt.expected, tt.ok), func(t *testing.T) {
+			tokenIDByTerm := make(map[string]TokenID)
+			for i, term := range tt.terms {
+				tokenIDByTerm[term] = TokenID(i + 1)
+			}
+			path, ok := longestShinglePath(tokenStream, tokenIDByTerm)
+			if ok != tt.ok {
+				t.Fatalf("longestShinglePath() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if diff := cmp.Diff(path.Terms(), tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPhraseSearch_WordDelimiter(t *testing.T) {
+	storage := newMemoryStorage()
+	analyzer := NewAnalyzer([]CharFilter{}, NewPatternTokenizer(regexp.MustCompile(`\s+`), -1), []TokenFilter{NewWordDelimiterFilter(WithCatenateAll()), NewLowercaseFilter()})
+	indexer := NewIndexer(storage, analyzer, 1)
+	for _, body := range []string{"Canon PowerShot-SD500 camera", "Power Shot SD 500", "getHTTPResponse()", "SD500 PowerShot"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		phrase   string
+		expected []string
+	}{
+		{phrase: "PowerShot SD500", expected: []string{"Canon PowerShot-SD500 camera", "Power Shot SD 500"}},
+		{phrase: "PowerShot-SD500 camera", expected: []string{"Canon PowerShot-SD500 camera"}},
+		{phrase: "http response", expected: []string{"getHTTPResponse()"}},
+		{phrase: "shot sd", expected: []string{"Canon PowerShot-SD500 camera", "Power Shot SD 500"}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("phrase = %v, expected = %v", tt.phrase, tt.expected), func(t *testing.T) {
+			docs, err := NewPhraseQuery(tt.phrase, analyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+// 重なったトークンが多くても経路を列挙せずに検索する
+func TestSearch_OverlappingTokens(t *testing.T) {
+	words := make([]string, 30)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	long := strings.Join(words, " ")
+
+	tests := []struct {
+		analyzer Analyzer
+		bodies   []string
+		query    string
+		and      []string
+		phrase   []string
+	}{
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewEdgeNgramFilter(1, 10, EdgeNgramFront)}),
+			bodies:   []string{"abcdefghij klmnopqrst uvwxyzabcd", "abcdefghij uvwxyzabcd klmnopqrst"},
+			query:    "abcdefghij klmnopqrst uvwxyzabcd",
+			and:      []string{"abcdefghij klmnopqrst uvwxyzabcd", "abcdefghij uvwxyzabcd klmnopqrst"},
+			phrase:   []string{"abcdefghij klmnopqrst uvwxyzabcd"},
+		},
+		{
+			analyzer: NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewShingleFilter(2, 3, " ", true)}),
+			bodies:   []string{long, strings.Join(words[1:], " ")},
+			query:    long,
+			and:      []string{long},
+			phrase:   []string{long},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("query = %v", tt.query), func(t *testing.T) {
+			storage := newMemoryStorage()
+			indexer := NewIndexer(storage, tt.analyzer, 1)
+			for _, body := range tt.bodies {
+				if err := indexer.AddDocument(NewDocument(body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, c := range []struct {
+				searcher Searcher
+				expected []string
+			}{
+				{searcher: NewMatchQuery(tt.query, AND, tt.analyzer, nil).Searcher(storage), expected: tt.and},
+				{searcher: NewPhraseQuery(tt.query, tt.analyzer, nil).Searcher(storage), expected: tt.phrase},
+			} {
+				docs, err := c.searcher.Search()
+				if err != nil {
+					t.Fatal(err)
+				}
+				bodies := make([]string, len(docs))
+				for i, doc := range docs {
+					bodies[i] = doc.Body
+				}
+				if diff := cmp.Diff(bodies, c.expected); diff != "" {
+					t.Errorf("Diff: (-got +want)\n%s", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package stalefish
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// スナップショットのフォーマットのバージョン
+// 互換性のない変更をする時にインクリメントする
+const SnapshotVersion = 1
+
+var (
+	ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+	ErrSnapshotChecksumMismatch   = errors.New("snapshot checksum mismatch")
+	ErrInconsistentSnapshot       = errors.New("inconsistent snapshot")
+	ErrStorageNotEmpty            = errors.New("storage to restore into is not empty")
+)
+
+// スナップショットに含まれるインデックスの統計情報
+type SnapshotStats struct {
+	Documents    int `json:"documents"`
+	Tokens       int `json:"tokens"`
+	PostingLists int `json:"posting_lists"`
+	Postings     int `json:"postings"`
+}
+
+// インデックス全体(ドキュメント、トークンの辞書、転置インデックス)のスナップショット
+// 特定のストレージに依存しないように、gzipで圧縮したJSONとして書き出す
+type snapshot struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Stats     SnapshotStats   `json:"stats"`
+	Checksum  string          `json:"checksum"` // payloadのSHA-256
+	Payload   snapshotPayload `json:"payload"`
+}
+
+type snapshotPayload struct {
+	Documents    []snapshotDocument    `json:"documents"`
+	Tokens       []snapshotToken       `json:"tokens"`
+	PostingLists []snapshotPostingList `json:"posting_lists"`
+}
+
+type snapshotDocument struct {
+	ID         DocumentID `json:"id"`
+	Body       string     `json:"body"`
+	TokenCount int        `json:"token_count"`
+}
+
+type snapshotToken struct {
+	ID   TokenID `json:"id"`
+	Term string  `json:"term"`
+}
+
+type snapshotPostingList struct {
+	TokenID  TokenID           `json:"token_id"`
+	Postings []snapshotPosting `json:"postings"`
+}
+
+type snapshotPosting struct {
+	DocumentID DocumentID `json:"document_id"`
+	Positions  []uint64   `json:"positions"`
+}
+
+func (p snapshotPayload) checksum() (string, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (p snapshotPayload) stats() SnapshotStats {
+	stats := SnapshotStats{
+		Documents:    len(p.Documents),
+		Tokens:       len(p.Tokens),
+		PostingLists: len(p.PostingLists),
+	}
+	for _, pl := range p.PostingLists {
+		stats.Postings += len(pl.Postings)
+	}
+	return stats
+}
+
+// ストレージのインデックス全体をスナップショットとして書き出す
+func ExportSnapshot(storage Storage, w io.Writer) (SnapshotStats, error) {
+	docs, err := storage.GetAllDocuments()
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	tokens, err := storage.GetAllTokens()
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	inverted, err := storage.GetInvertedIndexByTokenIDs(tokenIDs(tokens))
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+
+	var payload snapshotPayload
+	payload.Documents = make([]snapshotDocument, len(docs))
+	for i, doc := range docs {
+		payload.Documents[i] = snapshotDocument{ID: doc.ID, Body: doc.Body, TokenCount: doc.TokenCount}
+	}
+	sort.Slice(payload.Documents, func(i, j int) bool { return payload.Documents[i].ID < payload.Documents[j].ID })
+	payload.Tokens = make([]snapshotToken, len(tokens))
+	for i, token := range tokens {
+		payload.Tokens[i] = snapshotToken{ID: token.ID, Term: token.Term}
+	}
+	sort.Slice(payload.Tokens, func(i, j int) bool { return payload.Tokens[i].ID < payload.Tokens[j].ID })
+	payload.PostingLists = make([]snapshotPostingList, 0, len(inverted))
+	for _, tokenID := range inverted.TokenIDs() {
+		pl := snapshotPostingList{TokenID: tokenID, Postings: []snapshotPosting{}}
+		for p := inverted[tokenID].Postings; p != nil; p = p.Next {
+			pl.Postings = append(pl.Postings, snapshotPosting{DocumentID: p.DocumentID, Positions: p.Positions})
+		}
+		payload.PostingLists = append(payload.PostingLists, pl)
+	}
+
+	checksum, err := payload.checksum()
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	s := snapshot{
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Stats:     payload.stats(),
+		Checksum:  checksum,
+		Payload:   payload,
+	}
+	if err := writeSnapshot(w, s); err != nil {
+		return SnapshotStats{}, err
+	}
+	return s.Stats, nil
+}
+
+func writeSnapshot(w io.Writer, s snapshot) error {
+	gw := gzip.NewWriter(w)
+	if err := json.NewEncoder(gw).Encode(s); err != nil {
+		gw.Close()
+		return err
+	}
+	return gw.Close()
+}
+
+func readSnapshot(r io.Reader) (snapshot, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return snapshot{}, err
+	}
+	defer gr.Close()
+	var s snapshot
+	if err := json.NewDecoder(gr).Decode(&s); err != nil {
+		return snapshot{}, err
+	}
+	return s, nil
+}
+
+// スナップショットを空のストレージへ復元する
+// ドキュメントIDとトークンIDは復元先のストレージで採番し直し、転置インデックスもそれに合わせて書き換える
+func ImportSnapshot(storage Storage, r io.Reader) (SnapshotStats, error) {
+	s, err := readSnapshot(r)
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	if err := s.validate(); err != nil {
+		return SnapshotStats{}, err
+	}
+
+	// 既存のデータとIDが混ざらないように、空のストレージにのみ復元する
+	count, err := storage.CountDocuments()
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	tokens, err := storage.GetAllTokens()
+	if err != nil {
+		return SnapshotStats{}, err
+	}
+	if count != 0 || len(tokens) != 0 {
+		return SnapshotStats{}, ErrStorageNotEmpty
+	}
+
+	docIDMap := make(map[DocumentID]DocumentID, len(s.Payload.Documents))
+	for _, doc := range s.Payload.Documents {
+		id, err := storage.AddDocument(Document{Body: doc.Body, TokenCount: doc.TokenCount})
+		if err != nil {
+			return SnapshotStats{}, err
+		}
+		docIDMap[doc.ID] = id
+	}
+	tokenIDMap := make(map[TokenID]TokenID, len(s.Payload.Tokens))
+	for _, token := range s.Payload.Tokens {
+		id, err := storage.AddToken(Token{Term: token.Term})
+		if err != nil {
+			return SnapshotStats{}, err
+		}
+		tokenIDMap[token.ID] = id
+	}
+
+	inverted := InvertedIndex{}
+	for _, pl := range s.Payload.PostingLists {
+		postings := make([]snapshotPosting, len(pl.Postings))
+		for i, p := range pl.Postings {
+			postings[i] = snapshotPosting{DocumentID: docIDMap[p.DocumentID], Positions: p.Positions}
+		}
+		// 採番し直したドキュメントIDの昇順に並べ直す
+		sort.Slice(postings, func(i, j int) bool { return postings[i].DocumentID < postings[j].DocumentID })
+		var head *Postings
+		for i := len(postings) - 1; i >= 0; i-- {
+			head = NewPostings(postings[i].DocumentID, postings[i].Positions, head)
+		}
+		if head == nil {
+			continue
+		}
+		inverted[tokenIDMap[pl.TokenID]] = NewPostingList(head)
+	}
+	if len(inverted) > 0 {
+		if err := storage.UpsertInvertedIndex(inverted); err != nil {
+			return SnapshotStats{}, err
+		}
+	}
+
+	// 復元後のストレージがスナップショットと一致するか確認
+	if err := s.verifyRestored(storage, docIDMap); err != nil {
+		return SnapshotStats{}, err
+	}
+	return s.Stats, nil
+}
+
+// 復元先のドキュメント数、トークンの辞書、語句ごとのポスティングリストがスナップショットと一致するか確認する
+// ポスティングリストはドキュメントIDを採番し直したIDに置き換えた上で、語句ごとのチェックサムを比べる
+func (s snapshot) verifyRestored(storage Storage, docIDMap map[DocumentID]DocumentID) error {
+	count, err := storage.CountDocuments()
+	if err != nil {
+		return err
+	}
+	if count != s.Stats.Documents {
+		return fmt.Errorf("%w: restored %d documents, want %d", ErrInconsistentSnapshot, count, s.Stats.Documents)
+	}
+	tokens, err := storage.GetAllTokens()
+	if err != nil {
+		return err
+	}
+	if len(tokens) != s.Stats.Tokens {
+		return fmt.Errorf("%w: restored %d tokens, want %d", ErrInconsistentSnapshot, len(tokens), s.Stats.Tokens)
+	}
+
+	terms := make(map[TokenID]string, len(s.Payload.Tokens))
+	for _, token := range s.Payload.Tokens {
+		terms[token.ID] = token.Term
+	}
+	want := make(map[string]string, len(s.Payload.PostingLists))
+	for _, pl := range s.Payload.PostingLists {
+		postings := make([]snapshotPosting, len(pl.Postings))
+		for i, p := range pl.Postings {
+			postings[i] = snapshotPosting{DocumentID: docIDMap[p.DocumentID], Positions: p.Positions}
+		}
+		sort.Slice(postings, func(i, j int) bool { return postings[i].DocumentID < postings[j].DocumentID })
+		if len(postings) == 0 {
+			continue
+		}
+		sum, err := postingsChecksum(postings)
+		if err != nil {
+			return err
+		}
+		want[terms[pl.TokenID]] = sum
+	}
+
+	inverted, err := storage.GetInvertedIndexByTokenIDs(tokenIDs(tokens))
+	if err != nil {
+		return err
+	}
+	got := make(map[string]string, len(inverted))
+	for _, token := range tokens {
+		postings := make([]snapshotPosting, 0)
+		for p := inverted[token.ID].Postings; p != nil; p = p.Next {
+			postings = append(postings, snapshotPosting{DocumentID: p.DocumentID, Positions: p.Positions})
+		}
+		if len(postings) == 0 {
+			continue
+		}
+		sum, err := postingsChecksum(postings)
+		if err != nil {
+			return err
+		}
+		got[token.Term] = sum
+	}
+	if len(got) != len(want) {
+		return fmt.Errorf("%w: restored %d posting lists, want %d", ErrInconsistentSnapshot, len(got), len(want))
+	}
+	for term, sum := range want {
+		if got[term] != sum {
+			return fmt.Errorf("%w: restored postings for term %q differ from snapshot", ErrInconsistentSnapshot, term)
+		}
+	}
+	return nil
+}
+
+// ポスティングのSHA-256
+func postingsChecksum(postings []snapshotPosting) (string, error) {
+	b, err := json.Marshal(postings)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// スナップショットが壊れていないか、内部で矛盾していないかを検証する
+func (s snapshot) validate() error {
+	if s.Version != SnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSnapshotVersion, s.Version)
+	}
+	checksum, err := s.Payload.checksum()
+	if err != nil {
+		return err
+	}
+	if checksum != s.Checksum {
+		return ErrSnapshotChecksumMismatch
+	}
+	if stats := s.Payload.stats(); stats != s.Stats {
+		return fmt.Errorf("%w: stats %+v, want %+v", ErrInconsistentSnapshot, stats, s.Stats)
+	}
+
+	docs := make(map[DocumentID]struct{}, len(s.Payload.Documents))
+	for _, doc := range s.Payload.Documents {
+		if _, ok := docs[doc.ID]; ok {
+			return fmt.Errorf("%w: duplicate document %d", ErrInconsistentSnapshot, doc.ID)
+		}
+		docs[doc.ID] = struct{}{}
+	}
+	tokens := make(map[TokenID]struct{}, len(s.Payload.Tokens))
+	terms := make(map[string]struct{}, len(s.Payload.Tokens))
+	for _, token := range s.Payload.Tokens {
+		if _, ok := tokens[token.ID]; ok {
+			return fmt.Errorf("%w: duplicate token %d", ErrInconsistentSnapshot, token.ID)
+		}
+		if _, ok := terms[token.Term]; ok {
+			return fmt.Errorf("%w: duplicate term %q", ErrInconsistentSnapshot, token.Term)
+		}
+		tokens[token.ID] = struct{}{}
+		terms[token.Term] = struct{}{}
+	}
+	postingLists := make(map[TokenID]struct{}, len(s.Payload.PostingLists))
+	for _, pl := range s.Payload.PostingLists {
+		if _, ok := tokens[pl.TokenID]; !ok {
+			return fmt.Errorf("%w: posting list for unknown token %d", ErrInconsistentSnapshot, pl.TokenID)
+		}
+		if _, ok := postingLists[pl.TokenID]; ok {
+			return fmt.Errorf("%w: duplicate posting list for token %d", ErrInconsistentSnapshot, pl.TokenID)
+		}
+		postingLists[pl.TokenID] = struct{}{}
+		for i, p := range pl.Postings {
+			if _, ok := docs[p.DocumentID]; !ok {
+				return fmt.Errorf("%w: posting for unknown document %d", ErrInconsistentSnapshot, p.DocumentID)
+			}
+			if i > 0 && pl.Postings[i-1].DocumentID >= p.DocumentID {
+				return fmt.Errorf("%w: postings for token %d are not sorted", ErrInconsistentSnapshot, pl.TokenID)
+			}
+		}
+	}
+	return nil
+}
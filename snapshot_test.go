@@ -0,0 +1,175 @@
+package stalefish
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newSnapshotTestStorage(t *testing.T) *memoryStorage {
+	t.Helper()
+	storage := newMemoryStorage()
+	indexer := NewIndexer(storage, NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()}), 1)
+	for _, body := range []string{"Ruby PHP JS", "Go Ruby", "Ruby Go PHP", "Go PHP"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return storage
+}
+
+func TestSnapshot_ExportImport(t *testing.T) {
+	source := newSnapshotTestStorage(t)
+	segmented, err := NewStorageSegmentImpl(newMemoryStorage(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer segmented.Close()
+
+	cases := []struct {
+		name   string
+		target Storage
+	}{
+		{name: "memory", target: newMemoryStorage()},
+		{name: "segment", target: segmented},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			// Given
+			buf := bytes.NewBuffer(nil)
+			exported, err := ExportSnapshot(source, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(exported, SnapshotStats{Documents: 4, Tokens: 4, PostingLists: 4, Postings: 10}); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+
+			// When
+			imported, err := ImportSnapshot(tt.target, buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Then: 復元先でも同じ検索結果になる
+			if diff := cmp.Diff(imported, exported); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+			for _, keyword := range []string{"ruby", "go php", "js"} {
+				analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+				want, err := NewPhraseQuery(keyword, analyzer, nil).Searcher(source).Search()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := NewPhraseQuery(keyword, analyzer, nil).Searcher(tt.target).Search()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(got, want); diff != "" {
+					t.Errorf("keyword = %v, Diff: (-got +want)\n%s", keyword, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshot_ImportErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*snapshot)
+		target   func(*testing.T) Storage
+		expected error
+	}{
+		{
+			name:     "unsupported version",
+			modify:   func(s *snapshot) { s.Version = SnapshotVersion + 1 },
+			expected: ErrUnsupportedSnapshotVersion,
+		},
+		{
+			name:     "checksum mismatch",
+			modify:   func(s *snapshot) { s.Payload.Documents[0].Body = "tampered" },
+			expected: ErrSnapshotChecksumMismatch,
+		},
+		{
+			name: "posting for unknown document",
+			modify: func(s *snapshot) {
+				s.Payload.PostingLists[0].Postings[0].DocumentID = 99
+				s.Checksum, _ = s.Payload.checksum()
+			},
+			expected: ErrInconsistentSnapshot,
+		},
+		{
+			name: "stats mismatch",
+			modify: func(s *snapshot) {
+				s.Stats.Documents++
+			},
+			expected: ErrInconsistentSnapshot,
+		},
+		{
+			name:     "storage not empty",
+			modify:   func(s *snapshot) {},
+			target:   func(t *testing.T) Storage { return newSnapshotTestStorage(t) },
+			expected: ErrStorageNotEmpty,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v, expected = %v", tt.name, tt.expected), func(t *testing.T) {
+			// Given
+			buf := bytes.NewBuffer(nil)
+			if _, err := ExportSnapshot(newSnapshotTestStorage(t), buf); err != nil {
+				t.Fatal(err)
+			}
+			s, err := readSnapshot(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&s)
+			if err := writeSnapshot(buf, s); err != nil {
+				t.Fatal(err)
+			}
+			var target Storage = newMemoryStorage()
+			if tt.target != nil {
+				target = tt.target(t)
+			}
+
+			// When
+			_, err = ImportSnapshot(target, buf)
+
+			// Then
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("ImportSnapshot() = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+// 転置インデックスを保存する時に、1つのポスティングの位置を書き換えるストレージ
+type corruptingStorage struct {
+	*memoryStorage
+}
+
+func (s corruptingStorage) UpsertInvertedIndex(inverted InvertedIndex) error {
+	corrupted := inverted.Copy()
+	id := corrupted.TokenIDs()[0]
+	corrupted[id].Postings.Positions[0]++
+	return s.memoryStorage.UpsertInvertedIndex(corrupted)
+}
+
+func TestSnapshot_ImportCorruptedPostings(t *testing.T) {
+	// Given
+	buf := bytes.NewBuffer(nil)
+	if _, err := ExportSnapshot(newSnapshotTestStorage(t), buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	_, err := ImportSnapshot(corruptingStorage{newMemoryStorage()}, buf)
+
+	// Then: ドキュメント数とトークン数が一致していても、ポスティングの不一致を検出する
+	if !errors.Is(err, ErrInconsistentSnapshot) {
+		t.Errorf("ImportSnapshot() = %v, want %v", err, ErrInconsistentSnapshot)
+	}
+}
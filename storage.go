@@ -8,6 +8,7 @@ type Storage interface {
 	AddToken(token Token) (TokenID, error)                       // トークンを挿入する。挿入したドキュメントのIDを返す
 	GetTokenByTerm(string) (*Token, error)                       // 語句からトークンを取得する
 	GetTokensByTerms([]string) ([]Token, error)                  // 複数の語句から複数トークンを取得する
+	GetAllTokens() ([]Token, error)                              // 全てのトークンを返す
 	GetInvertedIndexByTokenIDs([]TokenID) (InvertedIndex, error) // 複数トークンIDから転置インデックスを取得する
 	UpsertInvertedIndex(InvertedIndex) error                     // 転置リストを更新する
 }
@@ -148,6 +148,14 @@ func (s StorageRdbImpl) GetTokensByTerms(terms []string) ([]Token, error) {
 	return tokens, nil
 }
 
+func (s StorageRdbImpl) GetAllTokens() ([]Token, error) {
+	var tokens []Token
+	if err := s.DB.Select(&tokens, `select * from tokens order by id`); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
 func (s StorageRdbImpl) GetInvertedIndexByTokenIDs(ids []TokenID) (InvertedIndex, error) {
 	if len(ids) == 0 {
 		return InvertedIndex{}, nil
@@ -193,6 +201,8 @@ func encode(invertedIndex InvertedIndex) ([]EncodedInvertedIndex, error) {
 	encoded := make([]EncodedInvertedIndex, 0)
 	for k, v := range invertedIndex {
 		// 差分を取る
+		// 呼び出し元の転置インデックスを検索中のリーダーと共有している場合があるので複製してから変換する
+		v = v.Copy()
 		var p *Postings = v.Postings
 		var beforeDocumentID DocumentID = 0
 		for p != nil {
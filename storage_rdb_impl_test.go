@@ -381,6 +381,31 @@ func TestGetTokensByTerms(t *testing.T) {
 	}
 }
 
+func TestStorageRdbImpl_GetAllTokens(t *testing.T) {
+	db, err := NewTestDBClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := truncateTableAll(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := insertTokens(db, []Token{
+		NewToken("term1"),
+		NewToken("term2"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := NewStorageRdbImpl(db)
+	tokens, err := storage.GetAllTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(tokens, []Token{{ID: 1, Term: "term1"}, {ID: 2, Term: "term2"}}); diff != "" {
+		t.Fatalf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
 func TestGetInvertedIndexByTokenIDs(t *testing.T) {
 	db, err := NewTestDBClient()
 	if err != nil {
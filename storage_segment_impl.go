@@ -0,0 +1,407 @@
+package stalefish
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 新しいセグメントとして転置インデックスを書き込めるストレージ
+// Indexerはストレージがこれを満たす時、ストレージ上のポスティングリストを読まずにセグメントを追加する
+type SegmentWriter interface {
+	WriteSegment(InvertedIndex) error
+}
+
+// 転置インデックスを不変なセグメントの集合として永続化するストレージ
+// ドキュメントとトークンの辞書はbaseに保存し、転置インデックスのみをdirにセグメントファイルとして保存する
+// 検索時は全てのセグメントのポスティングリストをマージして返し、
+// セグメントが増えてきたらマージポリシーに従ってバックグラウンドでセグメントをマージする
+type StorageSegmentImpl struct {
+	mu       sync.RWMutex
+	base     Storage
+	dir      string
+	policy   MergePolicy
+	segments []*segment
+	nextID   SegmentID
+	mergeMu  sync.Mutex // セグメントのマージは同時に一つだけ実行する
+	mergeErr error      // バックグラウンドのマージで発生し、まだ返していないエラー
+	trigger  chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// 不変なセグメント
+// 書き込み後に変更されることはないので、ロックなしで読み出せる
+type segment struct {
+	id            SegmentID
+	invertedIndex InvertedIndex
+	size          int
+}
+
+func newSegment(id SegmentID, invertedIndex InvertedIndex) *segment {
+	size := 0
+	for _, postingList := range invertedIndex {
+		size += postingList.Size()
+	}
+	return &segment{
+		id:            id,
+		invertedIndex: invertedIndex,
+		size:          size,
+	}
+}
+
+type SegmentOption func(*StorageSegmentImpl)
+
+func WithMergePolicy(policy MergePolicy) SegmentOption {
+	return func(s *StorageSegmentImpl) {
+		s.policy = policy
+	}
+}
+
+const segmentFileExt = ".seg"
+
+// dirに保存済みのセグメントを読み込み、バックグラウンドのマージを開始する
+func NewStorageSegmentImpl(base Storage, dir string, options ...SegmentOption) (*StorageSegmentImpl, error) {
+	s := &StorageSegmentImpl{
+		base:    base,
+		dir:     dir,
+		policy:  NewTieredMergePolicy(10, 10, 1000),
+		nextID:  1,
+		trigger: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.mergeInBackground()
+	return s, nil
+}
+
+func (s *StorageSegmentImpl) load() error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		name := f.Name()
+		// 書き込み途中でクラッシュした一時ファイルは削除する
+		if strings.HasSuffix(name, ".tmp") {
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, segmentFileExt) {
+			continue
+		}
+		var id SegmentID
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, segmentFileExt), "%d", &id); err != nil {
+			return fmt.Errorf("invalid segment file name %s: %w", name, err)
+		}
+		seg, err := s.readSegment(id)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, seg)
+		if id >= s.nextID {
+			s.nextID = id + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+	return nil
+}
+
+func (s *StorageSegmentImpl) segmentPath(id SegmentID) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", id, segmentFileExt))
+}
+
+func (s *StorageSegmentImpl) readSegment(id SegmentID) (*segment, error) {
+	b, err := ioutil.ReadFile(s.segmentPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var encoded []EncodedInvertedIndex
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&encoded); err != nil {
+		return nil, err
+	}
+	invertedIndex, err := decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return newSegment(id, invertedIndex), nil
+}
+
+// セグメントを一時ファイルに書き込んでからリネームし、読み込み時に中途半端なセグメントが見えないようにする
+// リネームがクラッシュ後も残るように、ディレクトリもディスクへ同期する
+func (s *StorageSegmentImpl) writeSegmentFile(seg *segment) error {
+	encoded, err := encode(seg.invertedIndex)
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(buf).Encode(encoded); err != nil {
+		return err
+	}
+
+	path := s.segmentPath(seg.id)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return syncDir(s.dir)
+}
+
+func (s *StorageSegmentImpl) allocateID() SegmentID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// 転置インデックスを新しいセグメントとして書き込む
+// 既存のセグメントは読み書きしないので、インデックスの大きさに関わらず一定のコストで済む
+func (s *StorageSegmentImpl) WriteSegment(invertedIndex InvertedIndex) error {
+	if len(invertedIndex) == 0 {
+		return nil
+	}
+	seg := newSegment(s.allocateID(), invertedIndex.Copy())
+	if err := s.writeSegmentFile(seg); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.segments = append(s.segments, seg)
+	s.mu.Unlock()
+
+	// バックグラウンドのマージを起こす
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// セグメントの一覧を返す
+func (s *StorageSegmentImpl) Segments() []SegmentInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	infos := make([]SegmentInfo, len(s.segments))
+	for i, seg := range s.segments {
+		infos[i] = SegmentInfo{ID: seg.id, Size: seg.size}
+	}
+	return infos
+}
+
+func (s *StorageSegmentImpl) mergeInBackground() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.trigger:
+			if err := s.MaybeMerge(); err != nil {
+				s.mu.Lock()
+				if s.mergeErr == nil {
+					s.mergeErr = err
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// マージポリシーが選んだセグメントを、マージすべきセグメントがなくなるまでマージする
+func (s *StorageSegmentImpl) MaybeMerge() error {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	for {
+		merges := s.policy.FindMerges(s.Segments())
+		if len(merges) == 0 {
+			return nil
+		}
+		for _, ids := range merges {
+			if err := s.mergeSegments(ids); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// 全てのセグメントを一つにマージする
+func (s *StorageSegmentImpl) ForceMerge() error {
+	s.mergeMu.Lock()
+	defer s.mergeMu.Unlock()
+	infos := s.Segments()
+	if len(infos) < 2 {
+		return nil
+	}
+	ids := make([]SegmentID, len(infos))
+	for i, info := range infos {
+		ids[i] = info.ID
+	}
+	return s.mergeSegments(ids)
+}
+
+// 複数のセグメントを一つのセグメントにマージし、元のセグメントと置き換える
+// 新しいセグメントの書き込み後、古いセグメントの削除前にクラッシュしても、
+// 読み出し時に同じドキュメントのポスティングは一つにまとめられるので検索結果は変わらない
+func (s *StorageSegmentImpl) mergeSegments(ids []SegmentID) error {
+	targets := make(map[SegmentID]struct{}, len(ids))
+	for _, id := range ids {
+		targets[id] = struct{}{}
+	}
+
+	s.mu.RLock()
+	sources := make([]*segment, 0, len(ids))
+	for _, seg := range s.segments {
+		if _, ok := targets[seg.id]; ok {
+			sources = append(sources, seg)
+		}
+	}
+	s.mu.RUnlock()
+	if len(sources) < 2 {
+		return nil
+	}
+
+	merged := InvertedIndex{}
+	for _, seg := range sources {
+		for tokenID, postingList := range seg.invertedIndex {
+			merged[tokenID] = merge(merged[tokenID], postingList)
+		}
+	}
+	seg := newSegment(s.allocateID(), merged)
+	if err := s.writeSegmentFile(seg); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	segments := make([]*segment, 0, len(s.segments)-len(sources)+1)
+	for _, old := range s.segments {
+		if _, ok := targets[old.id]; !ok {
+			segments = append(segments, old)
+		}
+	}
+	s.segments = append(segments, seg)
+	s.mu.Unlock()
+
+	for _, old := range sources {
+		if err := os.Remove(s.segmentPath(old.id)); err != nil {
+			return err
+		}
+	}
+	return syncDir(s.dir)
+}
+
+// バックグラウンドのマージが失敗していれば、まだ返していない最初のエラーを返す
+// 一度返したエラーは再び返さない
+func (s *StorageSegmentImpl) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.mergeErr
+	s.mergeErr = nil
+	return err
+}
+
+// バックグラウンドのマージを停止する
+// まだErrで返していないバックグラウンドのマージのエラーがあれば返す
+func (s *StorageSegmentImpl) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+	s.wg.Wait()
+	return s.Err()
+}
+
+func (s *StorageSegmentImpl) CountDocuments() (int, error) {
+	return s.base.CountDocuments()
+}
+
+func (s *StorageSegmentImpl) GetAllDocuments() ([]Document, error) {
+	return s.base.GetAllDocuments()
+}
+
+func (s *StorageSegmentImpl) GetDocuments(ids []DocumentID) ([]Document, error) {
+	return s.base.GetDocuments(ids)
+}
+
+func (s *StorageSegmentImpl) AddDocument(doc Document) (DocumentID, error) {
+	return s.base.AddDocument(doc)
+}
+
+func (s *StorageSegmentImpl) AddToken(token Token) (TokenID, error) {
+	return s.base.AddToken(token)
+}
+
+func (s *StorageSegmentImpl) GetTokenByTerm(term string) (*Token, error) {
+	return s.base.GetTokenByTerm(term)
+}
+
+func (s *StorageSegmentImpl) GetTokensByTerms(terms []string) ([]Token, error) {
+	return s.base.GetTokensByTerms(terms)
+}
+
+func (s *StorageSegmentImpl) GetAllTokens() ([]Token, error) {
+	return s.base.GetAllTokens()
+}
+
+// 全てのセグメントのポスティングリストをマージして返す
+func (s *StorageSegmentImpl) GetInvertedIndexByTokenIDs(ids []TokenID) (InvertedIndex, error) {
+	s.mu.RLock()
+	segments := s.segments
+	s.mu.RUnlock()
+
+	inverted := InvertedIndex{}
+	for _, id := range ids {
+		found := false
+		var merged PostingList
+		for _, seg := range segments {
+			postingList, ok := seg.invertedIndex[id]
+			if !ok {
+				continue
+			}
+			merged = merge(merged, postingList)
+			found = true
+		}
+		if found {
+			inverted[id] = merged
+		}
+	}
+	return inverted, nil
+}
+
+// 転置インデックスを新しいセグメントとして書き込む
+// 同じドキュメントのポスティングは読み出し時に一つにまとめられるので、既存のポスティングを含んでいても良い
+func (s *StorageSegmentImpl) UpsertInvertedIndex(invertedIndex InvertedIndex) error {
+	return s.WriteSegment(invertedIndex)
+}
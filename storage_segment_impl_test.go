@@ -0,0 +1,161 @@
+package stalefish
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStorageSegmentImpl_GetInvertedIndexByTokenIDs(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorageSegmentImpl(newMemoryStorage(), dir, WithMergePolicy(NewTieredMergePolicy(0, 0, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Given
+	segments := []InvertedIndex{
+		{1: NewPostingList(NewPostings(1, []uint64{0}, NewPostings(2, []uint64{1}, nil)))},
+		{1: NewPostingList(NewPostings(3, []uint64{2}, nil)), 2: NewPostingList(NewPostings(3, []uint64{0}, nil))},
+		// クラッシュ等で重複したポスティング
+		{2: NewPostingList(NewPostings(3, []uint64{0}, NewPostings(4, []uint64{5}, nil)))},
+	}
+	for _, seg := range segments {
+		if err := s.WriteSegment(seg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := InvertedIndex{
+		1: NewPostingList(NewPostings(1, []uint64{0}, NewPostings(2, []uint64{1}, NewPostings(3, []uint64{2}, nil)))),
+		2: NewPostingList(NewPostings(3, []uint64{0}, NewPostings(4, []uint64{5}, nil))),
+	}
+
+	// When
+	got, err := s.GetInvertedIndexByTokenIDs([]TokenID{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then
+	if diff := cmp.Diff(got, expected); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if len(s.Segments()) != 3 {
+		t.Errorf("len(Segments()) = %v, want 3", len(s.Segments()))
+	}
+
+	// When: 全てのセグメントをマージし、開き直す
+	if err := s.ForceMerge(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewStorageSegmentImpl(newMemoryStorage(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got, err = s.GetInvertedIndexByTokenIDs([]TokenID{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then
+	if diff := cmp.Diff(got, expected); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if diff := cmp.Diff(s.Segments(), []SegmentInfo{{ID: 4, Size: 5}}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestStorageSegmentImpl_MaybeMerge(t *testing.T) {
+	base := newMemoryStorage()
+	s, err := NewStorageSegmentImpl(base, t.TempDir(), WithMergePolicy(NewTieredMergePolicy(3, 3, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Given: 閾値ごとにセグメントを書き込むインデクサ
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{})
+	indexer := NewIndexer(s, analyzer, 100, WithMaxBufferedDocs(1))
+	for _, body := range []string{"aa bb", "bb cc", "aa cc", "aa", "bb", "cc", "aa bb cc"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// When
+	if err := s.MaybeMerge(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then: セグメントはマージされて減り、検索結果は変わらない
+	if n := len(s.Segments()); n >= 3 {
+		t.Errorf("len(Segments()) = %v, want < 3", n)
+	}
+	docs, err := NewMatchQuery("aa", AND, analyzer, nil).Searcher(s).Search()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]DocumentID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	if diff := cmp.Diff(ids, []DocumentID{1, 3, 4, 7}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+// セグメントが2つ以上になったらディレクトリを削除してマージさせ、マージを失敗させるマージポリシー
+type removingDirMergePolicy struct {
+	dir string
+}
+
+func (p removingDirMergePolicy) FindMerges(infos []SegmentInfo) [][]SegmentID {
+	if len(infos) < 2 {
+		return nil
+	}
+	os.RemoveAll(p.dir)
+	ids := make([]SegmentID, len(infos))
+	for i, info := range infos {
+		ids[i] = info.ID
+	}
+	return [][]SegmentID{ids}
+}
+
+func TestStorageSegmentImpl_Err(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStorageSegmentImpl(newMemoryStorage(), dir, WithMergePolicy(removingDirMergePolicy{dir: dir}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Given: バックグラウンドのマージが失敗する
+	for _, tokenID := range []TokenID{1, 2} {
+		if err := s.WriteSegment(InvertedIndex{tokenID: NewPostingList(NewPostings(1, []uint64{0}, nil))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// When
+	var got error
+	for deadline := time.Now().Add(time.Second); got == nil && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		got = s.Err()
+	}
+
+	// Then: エラーは一度だけ返す
+	if got == nil {
+		t.Fatal("Err() = nil, want error")
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,120 @@
+package stalefish
+
+import (
+	"sort"
+	"sync"
+)
+
+// テスト用のメモリ上のストレージ
+// 複数のゴルーチンから同時に利用できる
+type memoryStorage struct {
+	mu            sync.RWMutex
+	documents     []Document
+	tokens        []Token
+	invertedIndex InvertedIndex
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		invertedIndex: InvertedIndex{},
+	}
+}
+
+func (s *memoryStorage) CountDocuments() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.documents), nil
+}
+
+func (s *memoryStorage) GetAllDocuments() ([]Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]Document, len(s.documents))
+	copy(docs, s.documents)
+	return docs, nil
+}
+
+func (s *memoryStorage) GetDocuments(ids []DocumentID) ([]Document, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make([]Document, 0, len(ids))
+	for _, id := range ids {
+		if id == 0 || int(id) > len(s.documents) {
+			continue
+		}
+		docs = append(docs, s.documents[id-1])
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].ID < docs[j].ID })
+	return docs, nil
+}
+
+func (s *memoryStorage) AddDocument(doc Document) (DocumentID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc.ID = DocumentID(len(s.documents) + 1)
+	s.documents = append(s.documents, doc)
+	return doc.ID, nil
+}
+
+func (s *memoryStorage) AddToken(token Token) (TokenID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := TokenID(len(s.tokens) + 1)
+	s.tokens = append(s.tokens, Token{ID: id, Term: token.Term})
+	return id, nil
+}
+
+func (s *memoryStorage) GetTokenByTerm(term string) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, token := range s.tokens {
+		if token.Term == term {
+			t := token
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStorage) GetTokensByTerms(terms []string) ([]Token, error) {
+	tokens := make([]Token, 0, len(terms))
+	for _, term := range terms {
+		token, err := s.GetTokenByTerm(term)
+		if err != nil {
+			return nil, err
+		}
+		if token != nil {
+			tokens = append(tokens, *token)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *memoryStorage) GetAllTokens() ([]Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]Token, len(s.tokens))
+	copy(tokens, s.tokens)
+	return tokens, nil
+}
+
+func (s *memoryStorage) GetInvertedIndexByTokenIDs(ids []TokenID) (InvertedIndex, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	inverted := InvertedIndex{}
+	for _, id := range ids {
+		if postingList, ok := s.invertedIndex[id]; ok {
+			inverted[id] = postingList.Copy()
+		}
+	}
+	return inverted, nil
+}
+
+func (s *memoryStorage) UpsertInvertedIndex(inverted InvertedIndex) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, postingList := range inverted {
+		s.invertedIndex[id] = postingList.Copy()
+	}
+	return nil
+}
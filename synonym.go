@@ -0,0 +1,384 @@
+package stalefish
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidSynonymRule = errors.New("invalid synonym rule")
+
+// シノニムの定義ファイルの形式
+type SynonymFormat int
+
+const (
+	SynonymFormatSolr    SynonymFormat = iota + 1 // "a, b, c"(同義)、"a, b => c"(一方向)
+	SynonymFormatWordNet                          // WordNetのprologファイル(wn_s.pl)
+)
+
+// 語句の並びからシノニムの語句の並びへの対応
+// 語句の並びは空白区切りの文字列で表す
+type SynonymMap struct {
+	rules map[string][]synonymRule // 入力の先頭の語句->規則
+}
+
+type synonymRule struct {
+	input   []string
+	outputs [][]string
+}
+
+func NewSynonymMap() *SynonymMap {
+	return &SynonymMap{rules: make(map[string][]synonymRule)}
+}
+
+// 同義の語句を追加する
+// expandがtrueならそれぞれの語句を全ての語句に展開し、falseなら先頭の語句に置き換える
+func (m *SynonymMap) AddEquivalent(phrases []string, expand bool) {
+	if len(phrases) < 2 {
+		return
+	}
+	for _, phrase := range phrases {
+		if expand {
+			m.AddOneWay([]string{phrase}, phrases)
+			continue
+		}
+		m.AddOneWay([]string{phrase}, phrases[:1])
+	}
+}
+
+// inputsの語句をoutputsの語句に置き換える
+// 元の語句も残す時はoutputsに含める
+func (m *SynonymMap) AddOneWay(inputs, outputs []string) {
+	phrases := make([][]string, 0, len(outputs))
+	for _, out := range outputs {
+		if output := strings.Fields(out); len(output) > 0 {
+			phrases = append(phrases, output)
+		}
+	}
+	if len(phrases) == 0 {
+		return
+	}
+	for _, in := range inputs {
+		input := strings.Fields(in)
+		if len(input) == 0 {
+			continue
+		}
+		rule := m.rule(input)
+		for _, output := range phrases {
+			if !containsPhrase(rule.outputs, output) {
+				rule.outputs = append(rule.outputs, output)
+			}
+		}
+	}
+}
+
+// 入力が等しい規則を返す。なければ追加する
+func (m *SynonymMap) rule(input []string) *synonymRule {
+	rules := m.rules[input[0]]
+	for i := range rules {
+		if equalPhrase(rules[i].input, input) {
+			return &rules[i]
+		}
+	}
+	m.rules[input[0]] = append(rules, synonymRule{input: input})
+	return &m.rules[input[0]][len(rules)]
+}
+
+// 最も長い規則の入力の語句の数
+func (m *SynonymMap) maxInputLength() int {
+	max := 0
+	for _, rules := range m.rules {
+		for _, rule := range rules {
+			if len(rule.input) > max {
+				max = len(rule.input)
+			}
+		}
+	}
+	return max
+}
+
+func equalPhrase(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsPhrase(phrases [][]string, phrase []string) bool {
+	for _, p := range phrases {
+		if equalPhrase(p, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// シノニムの定義ファイルを読み込む
+func LoadSynonyms(path string, format SynonymFormat, expand bool) (*SynonymMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSynonyms(f, format, expand)
+}
+
+func ParseSynonyms(r io.Reader, format SynonymFormat, expand bool) (*SynonymMap, error) {
+	switch format {
+	case SynonymFormatSolr:
+		return parseSolrSynonyms(r, expand)
+	case SynonymFormatWordNet:
+		return parseWordNetSynonyms(r, expand)
+	}
+	return nil, fmt.Errorf("unknown synonym format: %d", format)
+}
+
+// 空行と#から始まる行は無視する
+func parseSolrSynonyms(r io.Reader, expand bool) (*SynonymMap, error) {
+	m := NewSynonymMap()
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sides := strings.Split(line, "=>")
+		switch len(sides) {
+		case 1:
+			m.AddEquivalent(splitSynonyms(sides[0]), expand)
+		case 2:
+			inputs, outputs := splitSynonyms(sides[0]), splitSynonyms(sides[1])
+			if len(inputs) == 0 || len(outputs) == 0 {
+				return nil, fmt.Errorf("%w: line %d: %q", ErrInvalidSynonymRule, n, line)
+			}
+			m.AddOneWay(inputs, outputs)
+		default:
+			return nil, fmt.Errorf("%w: line %d: %q", ErrInvalidSynonymRule, n, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// カンマ区切りの語句を空白を詰めて返す
+func splitSynonyms(s string) []string {
+	phrases := make([]string, 0)
+	for _, p := range strings.Split(s, ",") {
+		if phrase := strings.Join(strings.Fields(p), " "); phrase != "" {
+			phrases = append(phrases, phrase)
+		}
+	}
+	return phrases
+}
+
+// s(synset_id,w_num,'word',ss_type,sense_number,tag_count).
+var wordNetSynonymPattern = regexp.MustCompile(`^s\((\d+),\d+,'((?:[^']|'')*)',`)
+
+// 同じsynset_idの語句を同義として扱う
+func parseWordNetSynonyms(r io.Reader, expand bool) (*SynonymMap, error) {
+	synsets := make(map[string][]string)
+	ids := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		match := wordNetSynonymPattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("%w: line %d: %q", ErrInvalidSynonymRule, n, line)
+		}
+		id, word := match[1], strings.Replace(match[2], "''", "'", -1)
+		if _, ok := synsets[id]; !ok {
+			ids = append(ids, id)
+		}
+		synsets[id] = append(synsets[id], word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	m := NewSynonymMap()
+	for _, id := range ids {
+		m.AddEquivalent(synsets[id], expand)
+	}
+	return m, nil
+}
+
+// SynonymMapの語句の並びに一致するトークンの並びを、シノニムのトークンに置き換える
+// 複数語のシノニムはトークンのグラフとして出力し、置き換えた部分の全ての経路が同じ位置から始まり同じ位置で終わるように位置と位置の長さを設定する
+// 語句はそのまま比較するので、LowercaseFilter等の後に置く
+// インデックスには位置の長さを保存しないので、インデックス時はグラフを平坦化し、経路ごとの途中の位置を重ねてインデックスする
+type SynonymFilter struct {
+	synonyms *SynonymMap
+}
+
+func NewSynonymFilter(synonyms *SynonymMap) SynonymFilter {
+	return SynonymFilter{
+		synonyms: synonyms,
+	}
+}
+
+// 位置を決めたトークン
+type placedToken struct {
+	token    Token
+	position int
+}
+
+func (f SynonymFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+// 最も長い規則の入力の語句の数だけトークンを先読みする
+func (f SynonymFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return &synonymTokenIterator{
+		filter:       f,
+		source:       it,
+		lookahead:    f.synonyms.maxInputLength(),
+		position:     -1,
+		lastPosition: -1,
+	}
+}
+
+type synonymTokenIterator struct {
+	filter       SynonymFilter
+	source       TokenIterator
+	lookahead    int
+	window       []Token // 先読みしたトークン
+	positions    []int   // 先読みしたトークンの元の位置
+	position     int     // 最後に読んだトークンの元の位置
+	exhausted    bool
+	shift        int // シノニムで増減した位置の数
+	lastPosition int // 最後に出力したトークンの位置
+	pending      []Token
+	token        Token
+}
+
+func (it *synonymTokenIterator) Next() bool {
+	for len(it.pending) == 0 {
+		for !it.exhausted && (len(it.window) < it.lookahead || len(it.window) == 0) {
+			if !it.source.Next() {
+				it.exhausted = true
+				break
+			}
+			token := it.source.Token()
+			it.position += token.PositionIncrement
+			if it.position < 0 {
+				it.position = 0
+			}
+			it.window = append(it.window, token)
+			it.positions = append(it.positions, it.position)
+		}
+		if len(it.window) == 0 {
+			return false
+		}
+		placed, consumed := it.place()
+		// 置き換えた部分のトークンは、置き換えた部分の前後のトークンの間の位置にある
+		sort.SliceStable(placed, func(i, j int) bool { return placed[i].position < placed[j].position })
+		for _, p := range placed {
+			token := p.token
+			token.PositionIncrement = p.position - it.lastPosition
+			it.lastPosition = p.position
+			it.pending = append(it.pending, token)
+		}
+		it.window = append(it.window[:0], it.window[consumed:]...)
+		it.positions = append(it.positions[:0], it.positions[consumed:]...)
+	}
+	it.token, it.pending = it.pending[0], it.pending[1:]
+	return true
+}
+
+func (it *synonymTokenIterator) Token() Token {
+	return it.token
+}
+
+// 先読みしたトークンの先頭から、規則に一致すればシノニムのトークンを、一致しなければ先頭のトークンを位置を決めて返す
+// 処理した先読みしたトークンの数も返す
+func (it *synonymTokenIterator) place() ([]placedToken, int) {
+	start := it.positions[0] + it.shift
+	rule, ok := it.filter.match(it.window, 0)
+	if !ok {
+		return []placedToken{{token: it.window[0], position: start}}, 1
+	}
+	input := it.window[:len(rule.input)]
+	paths := it.filter.paths(rule, input)
+	// 経路ごとに途中の位置を別々に割り当て、異なる経路のトークンが繋がらないようにする
+	end := start + 1
+	for _, path := range paths {
+		end += len(path) - 1
+	}
+	placed := make([]placedToken, 0)
+	middle := start + 1
+	for _, path := range paths {
+		for j, token := range path {
+			from, to := start, end
+			if j > 0 {
+				from = middle - 1
+			}
+			if j < len(path)-1 {
+				to = middle
+				middle++
+			}
+			setPositionLength(to - from)(&token)
+			placed = append(placed, placedToken{token: token, position: from})
+		}
+	}
+	it.shift += end - start - len(input)
+	return placed, len(input)
+}
+
+// i番目のトークンから始まる最も長い規則を返す
+// 2番目以降のトークンは直前のトークンの次の位置にある必要がある
+func (f SynonymFilter) match(tokens []Token, i int) (synonymRule, bool) {
+	var longest synonymRule
+	found := false
+	for _, rule := range f.synonyms.rules[tokens[i].Term] {
+		if i+len(rule.input) > len(tokens) || (found && len(rule.input) <= len(longest.input)) {
+			continue
+		}
+		matched := true
+		for j := 1; j < len(rule.input); j++ {
+			t := tokens[i+j]
+			if t.Term != rule.input[j] || t.PositionIncrement != 1 {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			longest, found = rule, true
+		}
+	}
+	return longest, found
+}
+
+// 置き換えた部分の経路ごとのトークンを返す
+// 元の語句の並びは元のトークンをそのまま使い、他の経路より先に置く
+// シノニムのトークンのオフセットは置き換えた部分全体を指す
+func (f SynonymFilter) paths(rule synonymRule, input []Token) [][]Token {
+	paths := make([][]Token, 0, len(rule.outputs))
+	for _, output := range rule.outputs {
+		if equalPhrase(output, rule.input) {
+			path := make([]Token, len(input))
+			copy(path, input)
+			paths = append([][]Token{path}, paths...)
+			continue
+		}
+		path := make([]Token, len(output))
+		for j, term := range output {
+			path[j] = NewToken(term, setOffset(input[0].Start, input[len(input)-1].End), setType(TokenTypeSynonym))
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,265 @@
+package stalefish
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSynonyms(t *testing.T) {
+	tests := []struct {
+		format SynonymFormat
+		expand bool
+		text   string
+		want   map[string][]synonymRule
+	}{
+		{
+			format: SynonymFormatSolr,
+			expand: true,
+			text:   "# comment\n\njs, javascript\nny => new york, ny\n",
+			want: map[string][]synonymRule{
+				"js":         {{input: []string{"js"}, outputs: [][]string{{"js"}, {"javascript"}}}},
+				"javascript": {{input: []string{"javascript"}, outputs: [][]string{{"js"}, {"javascript"}}}},
+				"ny":         {{input: []string{"ny"}, outputs: [][]string{{"new", "york"}, {"ny"}}}},
+			},
+		},
+		{
+			format: SynonymFormatSolr,
+			expand: false,
+			text:   "hakuba, 白馬,  hakuba   valley",
+			want: map[string][]synonymRule{
+				"hakuba": {
+					{input: []string{"hakuba"}, outputs: [][]string{{"hakuba"}}},
+					{input: []string{"hakuba", "valley"}, outputs: [][]string{{"hakuba"}}},
+				},
+				"白馬": {{input: []string{"白馬"}, outputs: [][]string{{"hakuba"}}}},
+			},
+		},
+		{
+			format: SynonymFormatWordNet,
+			expand: true,
+			text:   "s(100001740,1,'entity',n,1,11).\ns(100002137,1,'abstraction',n,6,0).\ns(100002137,2,'abstract entity',n,1,0).\ns(100003553,1,'o''clock',n,1,0).\n",
+			want: map[string][]synonymRule{
+				"abstraction": {{input: []string{"abstraction"}, outputs: [][]string{{"abstraction"}, {"abstract", "entity"}}}},
+				"abstract":    {{input: []string{"abstract", "entity"}, outputs: [][]string{{"abstraction"}, {"abstract", "entity"}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("format = %v, expand = %v, text = %v", tt.format, tt.expand, tt.text), func(t *testing.T) {
+			m, err := ParseSynonyms(strings.NewReader(tt.text), tt.format, tt.expand)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(m.rules, tt.want, cmp.AllowUnexported(synonymRule{})); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSynonyms_Invalid(t *testing.T) {
+	tests := []struct {
+		format SynonymFormat
+		text   string
+	}{
+		{format: SynonymFormatSolr, text: "a => b => c"},
+		{format: SynonymFormatSolr, text: "a, b\n => c"},
+		{format: SynonymFormatWordNet, text: "g(100001740,'that which is perceived')."},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("format = %v, text = %v", tt.format, tt.text), func(t *testing.T) {
+			if _, err := ParseSynonyms(strings.NewReader(tt.text), tt.format, true); !errors.Is(err, ErrInvalidSynonymRule) {
+				t.Errorf("ParseSynonyms() error = %v, want %v", err, ErrInvalidSynonymRule)
+			}
+		})
+	}
+}
+
+func TestSynonymFilter_Filter(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader("js, javascript\nny, new york\nnyc => new york city"), SynonymFormatSolr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tokenStream TokenStream
+		want        TokenStream
+	}{
+		{
+			tokenStream: NewTokenStream([]Token{NewToken("learn", setOffset(0, 5)), NewToken("js", setOffset(6, 8))}),
+			want: NewTokenStream([]Token{
+				NewToken("learn", setOffset(0, 5)),
+				NewToken("js", setOffset(6, 8)),
+				NewToken("javascript", setOffset(6, 8), setType(TokenTypeSynonym), setPositionIncrement(0)),
+			}),
+		},
+		{
+			// 短い経路のトークンは長い経路と同じ位置で終わるように位置の長さを伸ばす
+			tokenStream: NewTokenStream([]Token{NewToken("ny", setOffset(0, 2)), NewToken("city", setOffset(3, 7))}),
+			want: NewTokenStream([]Token{
+				NewToken("ny", setOffset(0, 2), setPositionLength(2)),
+				NewToken("new", setOffset(0, 2), setType(TokenTypeSynonym), setPositionIncrement(0)),
+				NewToken("york", setOffset(0, 2), setType(TokenTypeSynonym)),
+				NewToken("city", setOffset(3, 7)),
+			}),
+		},
+		{
+			tokenStream: NewTokenStream([]Token{NewToken("new", setOffset(0, 3)), NewToken("york", setOffset(4, 8)), NewToken("city", setOffset(9, 13))}),
+			want: NewTokenStream([]Token{
+				NewToken("new", setOffset(0, 3)),
+				NewToken("ny", setOffset(0, 8), setType(TokenTypeSynonym), setPositionIncrement(0), setPositionLength(2)),
+				NewToken("york", setOffset(4, 8)),
+				NewToken("city", setOffset(9, 13)),
+			}),
+		},
+		{
+			// 一方向の規則では元のトークンを残さない
+			tokenStream: NewTokenStream([]Token{NewToken("nyc", setOffset(0, 3)), NewToken("tour", setOffset(4, 8), setPositionIncrement(2))}),
+			want: NewTokenStream([]Token{
+				NewToken("new", setOffset(0, 3), setType(TokenTypeSynonym)),
+				NewToken("york", setOffset(0, 3), setType(TokenTypeSynonym)),
+				NewToken("city", setOffset(0, 3), setType(TokenTypeSynonym)),
+				NewToken("tour", setOffset(4, 8), setPositionIncrement(2)),
+			}),
+		},
+		{
+			// 途中に空いた位置があれば複数語には一致しない
+			tokenStream: NewTokenStream([]Token{NewToken("new"), NewToken("york", setPositionIncrement(2))}),
+			want:        NewTokenStream([]Token{NewToken("new"), NewToken("york", setPositionIncrement(2))}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("tokenStream = %v", tt.tokenStream.Terms()), func(t *testing.T) {
+			got := NewSynonymFilter(synonyms).Filter(tt.tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+// 検索時にシノニムを展開し、経路ごとにフレーズを検索する
+func TestPhraseSearch_Synonym(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader("ny, new york"), SynonymFormatSolr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := newMemoryStorage()
+	indexAnalyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()})
+	searchAnalyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewSynonymFilter(synonyms)})
+	indexer := NewIndexer(storage, indexAnalyzer, 1)
+	for _, body := range []string{"New York city tour", "NY city tour", "york city", "new ny city"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		phrase   string
+		expected []string
+	}{
+		{phrase: "ny city", expected: []string{"New York city tour", "NY city tour", "new ny city"}},
+		{phrase: "new york city", expected: []string{"New York city tour", "NY city tour", "new ny city"}},
+		{phrase: "york city", expected: []string{"New York city tour", "york city"}},
+		{phrase: "new ny", expected: []string{"new ny city"}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("phrase = %v, expected = %v", tt.phrase, tt.expected), func(t *testing.T) {
+			docs, err := NewPhraseQuery(tt.phrase, searchAnalyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMatchSearch_Synonym(t *testing.T) {
+	synonyms, err := ParseSynonyms(strings.NewReader("ny, new york"), SynonymFormatSolr, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := newMemoryStorage()
+	indexAnalyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter()})
+	searchAnalyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewSynonymFilter(synonyms)})
+	indexer := NewIndexer(storage, indexAnalyzer, 1)
+	for _, body := range []string{"NY tour", "New York tour", "new tour", "NY city"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		keyword  string
+		expected []string
+	}{
+		// いずれかの経路の語句を全て含むドキュメントにマッチする
+		{keyword: "ny", expected: []string{"NY tour", "New York tour", "NY city"}},
+		{keyword: "ny tour", expected: []string{"NY tour", "New York tour"}},
+		{keyword: "new york tour", expected: []string{"NY tour", "New York tour"}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("keyword = %v, expected = %v", tt.keyword, tt.expected), func(t *testing.T) {
+			docs, err := NewMatchQuery(tt.keyword, AND, searchAnalyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+// インデックス時に複数語のシノニムを展開しても、どの表記のフレーズでも検索できる
+func TestPhraseSearch_IndexTimeSynonym(t *testing.T) {
+	synonyms := NewSynonymMap()
+	synonyms.AddEquivalent([]string{"ny", "new york", "big apple"}, true)
+	storage := newMemoryStorage()
+	analyzer := NewAnalyzer([]CharFilter{}, NewStandardTokenizer(), []TokenFilter{NewLowercaseFilter(), NewSynonymFilter(synonyms)})
+	indexer := NewIndexer(storage, analyzer, 1)
+	for _, body := range []string{"ny rocks", "new york rocks", "big apple pie", "york rocks"} {
+		if err := indexer.AddDocument(NewDocument(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		phrase   string
+		expected []string
+	}{
+		{phrase: "ny rocks", expected: []string{"ny rocks", "new york rocks"}},
+		{phrase: "new york rocks", expected: []string{"ny rocks", "new york rocks"}},
+		{phrase: "big apple rocks", expected: []string{"ny rocks", "new york rocks"}},
+		{phrase: "ny pie", expected: []string{"big apple pie"}},
+		{phrase: "york rocks", expected: []string{"ny rocks", "new york rocks", "york rocks"}},
+	}
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("phrase = %v, expected = %v", tt.phrase, tt.expected), func(t *testing.T) {
+			docs, err := NewPhraseQuery(tt.phrase, analyzer, nil).Searcher(storage).Search()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bodies := make([]string, len(docs))
+			for i, doc := range docs {
+				bodies[i] = doc.Body
+			}
+			if diff := cmp.Diff(bodies, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
@@ -2,16 +2,40 @@ package stalefish
 
 type TokenID uint64
 
+// トークンの種類
+const (
+	TokenTypeAlphanum = "<ALPHANUM>" // 英数字
+	TokenTypeNum      = "<NUM>"      // 数字のみ
+	TokenTypeNgram    = "<NGRAM>"    // N-gram
+	TokenTypeMorpheme = "<MORPHEME>" // 形態素
+	TokenTypePattern  = "<PATTERN>"  // 正規表現で区切ったもの
+	TokenTypeCJK      = "<CJK>"      // 漢字、ひらがな、カタカナ、ハングルのバイグラム
+	TokenTypeSynonym  = "<SYNONYM>"  // シノニムとして追加したもの
+	TokenTypeShingle  = "<SHINGLE>"  // 連続するトークンを繋げたもの
+)
+
+// トークン
+// トークナイザが付与した属性は、全ての組み込みのTokenFilterで引き継がれる
 type Token struct {
-	ID   TokenID `db:"id"`
-	Term string  `db:"term"`
-	Kana string  `db:"kana"`
+	ID                TokenID `db:"id"`
+	Term              string  `db:"term"`
+	Kana              string  `db:"kana"`
+	PartOfSpeech      string  `db:"-"` // 品詞
+	BaseForm          string  `db:"-"` // 原形
+	InflectionType    string  `db:"-"` // 活用型
+	InflectionForm    string  `db:"-"` // 活用形
+	Type              string  `db:"-"` // トークンの種類
+	Start             int     `db:"-"` // トークナイザに渡された文字列中での開始位置(バイト)
+	End               int     `db:"-"` // トークナイザに渡された文字列中での終了位置(バイト)
+	PositionIncrement int     `db:"-"` // 直前のトークンからの位置の増分。0なら直前のトークンと同じ位置に重なる。NewTokenは1にする
+	PositionLength    int     `db:"-"` // トークンがまたがる位置の数。0は1とみなす。複数語のシノニムと重なるトークンは1より大きくなる
+	Keyword           bool    `db:"-"` // trueならステミング等で語句を変更しない
 }
 
 type TokenOption func(*Token)
 
 func NewToken(term string, options ...TokenOption) Token {
-	token := Token{Term: term}
+	token := Token{Term: term, PositionIncrement: 1}
 	for _, option := range options {
 		option(&token)
 	}
@@ -24,6 +48,60 @@ func setKana(kana string) TokenOption {
 	}
 }
 
+func setPartOfSpeech(pos string) TokenOption {
+	return func(s *Token) {
+		s.PartOfSpeech = pos
+	}
+}
+
+func setBaseForm(baseForm string) TokenOption {
+	return func(s *Token) {
+		s.BaseForm = baseForm
+	}
+}
+
+func setInflection(inflectionType, inflectionForm string) TokenOption {
+	return func(s *Token) {
+		s.InflectionType = inflectionType
+		s.InflectionForm = inflectionForm
+	}
+}
+
+func setType(typ string) TokenOption {
+	return func(s *Token) {
+		s.Type = typ
+	}
+}
+
+func setOffset(start, end int) TokenOption {
+	return func(s *Token) {
+		s.Start = start
+		s.End = end
+	}
+}
+
+// 0なら直前のトークンと同じ位置に重ねる
+func setPositionIncrement(inc int) TokenOption {
+	return func(s *Token) {
+		s.PositionIncrement = inc
+	}
+}
+
+func setPositionLength(length int) TokenOption {
+	return func(s *Token) {
+		s.PositionLength = 0
+		if length > 1 {
+			s.PositionLength = length
+		}
+	}
+}
+
+func setKeyword(keyword bool) TokenOption {
+	return func(s *Token) {
+		s.Keyword = keyword
+	}
+}
+
 type TokenStream struct {
 	Tokens []Token
 }
@@ -45,3 +123,122 @@ func (ts TokenStream) Terms() []string {
 	}
 	return terms
 }
+
+// 位置の増分から各トークンの位置を求める
+// 先頭のトークンの位置は0になる
+func (ts TokenStream) Positions() []uint64 {
+	positions := make([]uint64, ts.Size())
+	var pos uint64
+	for i, t := range ts.Tokens {
+		inc := t.PositionIncrement
+		if i > 0 {
+			pos += uint64(inc)
+		}
+		if i == 0 && inc > 1 {
+			pos = uint64(inc - 1)
+		}
+		positions[i] = pos
+	}
+	return positions
+}
+
+// トークンの位置を節点、トークンを位置から位置の長さだけ先の位置への辺とみなしたグラフの、先頭から末尾までの全ての経路を返す
+// 各経路はトークンが重ならないTokenStreamで、トークンの間の空いた位置は位置の増分として引き継ぐ
+// トークンが重なっていなければ、同じトークンからなる経路を一つだけ返す
+func (ts TokenStream) Paths() []TokenStream {
+	if ts.Size() == 0 {
+		return []TokenStream{}
+	}
+	positions := ts.Positions()
+	ends := make([]uint64, ts.Size())
+	for i, t := range ts.Tokens {
+		ends[i] = positions[i] + uint64(positionLength(t))
+	}
+	// 位置pから出る辺の次に続く辺の候補(p以降で最も近い位置から出る辺)
+	nextTokens := func(p uint64) []int {
+		var r []int
+		for i := range ts.Tokens {
+			if positions[i] < p || (len(r) > 0 && positions[i] > positions[r[0]]) {
+				continue
+			}
+			if len(r) > 0 && positions[i] < positions[r[0]] {
+				r = r[:0]
+			}
+			r = append(r, i)
+		}
+		return r
+	}
+
+	paths := make([]TokenStream, 0)
+	var walk func(path []int, i int)
+	walk = func(path []int, i int) {
+		path = append(path[:len(path):len(path)], i)
+		next := nextTokens(ends[i])
+		if len(next) > 0 {
+			for _, j := range next {
+				walk(path, j)
+			}
+			return
+		}
+		tokens := make([]Token, len(path))
+		for j, k := range path {
+			tokens[j] = ts.Tokens[k]
+			if j > 0 {
+				tokens[j].PositionIncrement = int(positions[k]-ends[path[j-1]]) + 1
+			}
+		}
+		paths = append(paths, NewTokenStream(tokens))
+	}
+	for _, i := range nextTokens(positions[0]) {
+		walk(nil, i)
+	}
+	return paths
+}
+
+// 位置の長さが設定されていないトークンは1つの位置を占めるとみなす
+func positionLength(t Token) int {
+	if t.PositionLength < 1 {
+		return 1
+	}
+	return t.PositionLength
+}
+
+// トークンを先頭から1つずつ返すイテレータ
+// Nextがtrueを返した後に、Tokenで現在のトークンを取り出す
+// 全てのトークンをスライスにしないので、大きな文字列でもトークン数に比例したメモリを使わない
+type TokenIterator interface {
+	Next() bool
+	Token() Token
+}
+
+// TokenStreamのトークンを順に返すイテレータ
+func (ts TokenStream) Iterator() TokenIterator {
+	return &sliceTokenIterator{tokens: ts.Tokens, index: -1}
+}
+
+type sliceTokenIterator struct {
+	tokens []Token
+	index  int
+}
+
+func (it *sliceTokenIterator) Next() bool {
+	if it.index+1 >= len(it.tokens) {
+		it.index = len(it.tokens)
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *sliceTokenIterator) Token() Token {
+	return it.tokens[it.index]
+}
+
+// イテレータの残りのトークンを全て読み出してTokenStreamにする
+func CollectTokens(it TokenIterator) TokenStream {
+	tokens := make([]Token, 0)
+	for it.Next() {
+		tokens = append(tokens, it.Token())
+	}
+	return NewTokenStream(tokens)
+}
@@ -2,15 +2,214 @@ package stalefish
 
 import (
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
-	"github.com/kljensen/snowball/english"
 	"github.com/kotaroooo0/gojaconv/jaconv"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
 )
 
+// TokenFilterは語句以外の属性(カナ、品詞、オフセット、位置の増分等)を引き継ぎ、
+// 受け取ったTokenStreamは変更せずに新しいTokenStreamを返す
 type TokenFilter interface {
 	Filter(TokenStream) TokenStream
 }
 
+// トークンを1つずつ処理できるTokenFilter
+// Analyzer.AnalyzeIteratorは、前段のイテレータから読んだトークンをそのまま後段に渡す
+type StreamingTokenFilter interface {
+	TokenFilter
+	FilterIterator(TokenIterator) TokenIterator
+}
+
+// StreamingTokenFilterでなければ、最初にNextを呼んだ時に残りのトークンを全て読み出してFilterを適用する
+func filterIterator(filter TokenFilter, it TokenIterator) TokenIterator {
+	if sf, ok := filter.(StreamingTokenFilter); ok {
+		return sf.FilterIterator(it)
+	}
+	return &bufferedFilterTokenIterator{filter: filter, source: it}
+}
+
+type bufferedFilterTokenIterator struct {
+	filter   TokenFilter
+	source   TokenIterator
+	filtered TokenIterator
+}
+
+func (it *bufferedFilterTokenIterator) Next() bool {
+	if it.filtered == nil {
+		it.filtered = it.filter.Filter(CollectTokens(it.source)).Iterator()
+	}
+	return it.filtered.Next()
+}
+
+func (it *bufferedFilterTokenIterator) Token() Token {
+	return it.filtered.Token()
+}
+
+// トークンを1つずつ変換するイテレータ
+// mapTokenがfalseを返したトークンは取り除き、その位置の増分は次のトークンに加算する
+type mapTokenIterator struct {
+	source   TokenIterator
+	mapToken func(Token) (Token, bool)
+	token    Token
+	skipped  int
+}
+
+func newMapTokenIterator(source TokenIterator, mapToken func(Token) (Token, bool)) *mapTokenIterator {
+	return &mapTokenIterator{
+		source:   source,
+		mapToken: mapToken,
+	}
+}
+
+func (it *mapTokenIterator) Next() bool {
+	for it.source.Next() {
+		token := it.source.Token()
+		mapped, ok := it.mapToken(token)
+		if !ok {
+			it.skipped += token.PositionIncrement
+			continue
+		}
+		if it.skipped > 0 {
+			mapped.PositionIncrement += it.skipped
+		}
+		it.skipped = 0
+		it.token = mapped
+		return true
+	}
+	return false
+}
+
+func (it *mapTokenIterator) Token() Token {
+	return it.token
+}
+
+// トークンを0個以上のトークンに変換するイテレータ
+// 変換したトークンの位置の増分は、先頭のトークンが元のトークンの位置の増分を引き継ぐように設定する
+// 空のスライスを返したトークンは取り除き、その位置の増分は次のトークンに加算する
+type expandTokenIterator struct {
+	source  TokenIterator
+	expand  func(Token) []Token
+	pending []Token
+	token   Token
+	skipped int
+}
+
+func newExpandTokenIterator(source TokenIterator, expand func(Token) []Token) *expandTokenIterator {
+	return &expandTokenIterator{
+		source: source,
+		expand: expand,
+	}
+}
+
+func (it *expandTokenIterator) Next() bool {
+	if len(it.pending) > 0 {
+		it.token, it.pending = it.pending[0], it.pending[1:]
+		return true
+	}
+	for it.source.Next() {
+		token := it.source.Token()
+		expanded := it.expand(token)
+		if len(expanded) == 0 {
+			it.skipped += token.PositionIncrement
+			continue
+		}
+		if it.skipped > 0 {
+			expanded[0].PositionIncrement += it.skipped
+		}
+		it.skipped = 0
+		it.token, it.pending = expanded[0], expanded[1:]
+		return true
+	}
+	return false
+}
+
+func (it *expandTokenIterator) Token() Token {
+	return it.token
+}
+
+// トークンのグラフを、各トークンの位置の長さを1とみなしても経路が途切れないように平坦化するイテレータ
+// インデックスには位置の長さを保存しないので、シノニム等の複数語の経路ごとに置いた途中の位置を、他の経路の同じ順番の位置に重ねる
+// トークンの位置は、そこで終わるトークンの平坦化した位置の次の位置(空いた位置があればその分先)のうち最も後の位置にする
+// 先頭以外に、そこで終わるトークンがないのにトークンが始まる位置があればグラフとして平坦化できないので、以降は位置の差を保つ
+// 平坦化したトークンの位置の長さは1にする
+type flattenGraphTokenIterator struct {
+	source  TokenIterator
+	token   Token
+	started bool
+	input   uint64            // 直前のトークンの元の位置
+	output  uint64            // 直前のトークンの平坦化した位置
+	ends    map[uint64]uint64 // トークンが終わる元の位置から、そこに続くトークンの平坦化した位置
+	broken  bool
+}
+
+func newFlattenGraphTokenIterator(source TokenIterator) *flattenGraphTokenIterator {
+	return &flattenGraphTokenIterator{
+		source: source,
+		ends:   make(map[uint64]uint64),
+	}
+}
+
+func (it *flattenGraphTokenIterator) Next() bool {
+	if !it.source.Next() {
+		return false
+	}
+	token := it.source.Token()
+	inc := token.PositionIncrement
+	var input, output uint64
+	switch {
+	case !it.started:
+		if inc > 1 {
+			input = uint64(inc - 1)
+		}
+		output = input
+	case inc == 0:
+		input, output = it.input, it.output
+	default:
+		input = it.input + uint64(inc)
+		output = it.output + uint64(inc)
+		if !it.broken {
+			found := false
+			for end, next := range it.ends {
+				if end > input {
+					continue
+				}
+				if next+input-end > output || !found {
+					output = next + input - end
+				}
+				found = true
+				delete(it.ends, end)
+			}
+			if !found {
+				it.broken = true
+				output = it.output + uint64(inc)
+			}
+		}
+	}
+	if !it.broken {
+		end := input + uint64(positionLength(token))
+		if next, ok := it.ends[end]; !ok || next < output+1 {
+			it.ends[end] = output + 1
+		}
+	}
+
+	if !it.started {
+		token.PositionIncrement = int(output) + 1
+	} else {
+		token.PositionIncrement = int(output - it.output)
+	}
+	token.PositionLength = 0
+	it.started, it.input, it.output = true, input, output
+	it.token = token
+	return true
+}
+
+func (it *flattenGraphTokenIterator) Token() Token {
+	return it.token
+}
+
 type LowercaseFilter struct{}
 
 func NewLowercaseFilter() LowercaseFilter {
@@ -18,12 +217,14 @@ func NewLowercaseFilter() LowercaseFilter {
 }
 
 func (f LowercaseFilter) Filter(tokenStream TokenStream) TokenStream {
-	r := make([]Token, tokenStream.Size())
-	for i, token := range tokenStream.Tokens {
-		lower := strings.ToLower(token.Term)
-		r[i] = NewToken(lower)
-	}
-	return NewTokenStream(r)
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f LowercaseFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		token.Term = strings.ToLower(token.Term)
+		return token, true
+	})
 }
 
 type StopWordFilter struct {
@@ -36,33 +237,182 @@ func NewStopWordFilter(stopWords []string) StopWordFilter {
 	}
 }
 
+// 取り除いたトークンの位置の増分は次のトークンに加算し、フレーズ検索で位置がずれないようにする
 func (f StopWordFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f StopWordFilter) FilterIterator(it TokenIterator) TokenIterator {
 	stopwords := make(map[string]struct{})
 	for _, w := range f.stopWords {
 		stopwords[w] = struct{}{}
 	}
-	r := make([]Token, 0, tokenStream.Size())
-	for _, token := range tokenStream.Tokens {
-		if _, ok := stopwords[token.Term]; !ok {
-			r = append(r, token)
-		}
-	}
-	return NewTokenStream(r)
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		_, ok := stopwords[token.Term]
+		return token, !ok
+	})
 }
 
-type StemmerFilter struct{}
+// Snowballで語幹を取り出す
+// 言語を指定しなければ英語として扱い、対応していない言語なら変更しない
+type StemmerFilter struct {
+	language Language
+}
 
 func NewStemmerFilter() StemmerFilter {
-	return StemmerFilter{}
+	return StemmerFilter{language: English}
+}
+
+func NewSnowballStemmerFilter(language Language) StemmerFilter {
+	return StemmerFilter{language: language}
 }
 
 func (f StemmerFilter) Filter(tokenStream TokenStream) TokenStream {
-	r := make([]Token, tokenStream.Size())
-	for i, token := range tokenStream.Tokens {
-		stemmed := english.Stem(token.Term, false)
-		r[i] = NewToken(stemmed)
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f StemmerFilter) FilterIterator(it TokenIterator) TokenIterator {
+	language := f.language
+	if language == "" {
+		language = English
 	}
-	return NewTokenStream(r)
+	stem, ok := snowballStemmers[language]
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		if ok && !token.Keyword {
+			token.Term = stem(token.Term, false)
+		}
+		return token, true
+	})
+}
+
+// 指定した語句のトークンをキーワードとしてマークし、ステミング等で変更されないようにする
+type KeywordMarkerFilter struct {
+	keywords []string
+}
+
+func NewKeywordMarkerFilter(keywords []string) KeywordMarkerFilter {
+	return KeywordMarkerFilter{
+		keywords: keywords,
+	}
+}
+
+func (f KeywordMarkerFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f KeywordMarkerFilter) FilterIterator(it TokenIterator) TokenIterator {
+	keywords := make(map[string]struct{})
+	for _, w := range f.keywords {
+		keywords[w] = struct{}{}
+	}
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		if _, ok := keywords[token.Term]; ok {
+			token.Keyword = true
+		}
+		return token, true
+	})
+}
+
+// 形態素解析で除くことが多い品詞
+var DefaultJapanesePOSStopTags = []string{"接続詞", "助詞", "助動詞", "記号", "フィラー", "非言語音"}
+
+// 品詞が指定した品詞のいずれかに当たるトークンを取り除く
+// "助詞"を指定すると"助詞-係助詞"等の細分類も取り除く
+type JapanesePOSStopFilter struct {
+	stopTags []string
+}
+
+func NewJapanesePOSStopFilter(stopTags []string) JapanesePOSStopFilter {
+	return JapanesePOSStopFilter{
+		stopTags: stopTags,
+	}
+}
+
+// 取り除いたトークンの位置の増分は次のトークンに加算する
+func (f JapanesePOSStopFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f JapanesePOSStopFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		return token, !f.isStopTag(token.PartOfSpeech)
+	})
+}
+
+func (f JapanesePOSStopFilter) isStopTag(pos string) bool {
+	for _, tag := range f.stopTags {
+		if pos == tag || strings.HasPrefix(pos, tag+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// 活用する語を原形に置き換える(滑り→滑る)
+// 形態素解析器は活用しない語にも辞書の原形を付けるので、活用型を持つトークンだけを置き換える
+// 活用しない語(バレイ等)は辞書の原形が表層形と異なっても変更せず、キーワードのトークンも変更しない
+type JapaneseBaseFormFilter struct{}
+
+func NewJapaneseBaseFormFilter() JapaneseBaseFormFilter {
+	return JapaneseBaseFormFilter{}
+}
+
+func (f JapaneseBaseFormFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f JapaneseBaseFormFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		if token.InflectionType != "" && token.BaseForm != "" && !token.Keyword {
+			token.Term = token.BaseForm
+		}
+		return token, true
+	})
+}
+
+// 長音記号を取り除かないカタカナの最小の長さ
+const DefaultKatakanaStemMinLength = 4
+
+// minLengthより長いカタカナのトークンの末尾の長音記号を取り除く(コンピューター→コンピュータ)
+// minLength以下の短い語(メーカー等)は長音記号の有無で別の語になりやすいので変更しない
+type JapaneseKatakanaStemFilter struct {
+	minLength int
+}
+
+func NewJapaneseKatakanaStemFilter(minLength int) JapaneseKatakanaStemFilter {
+	return JapaneseKatakanaStemFilter{
+		minLength: minLength,
+	}
+}
+
+func (f JapaneseKatakanaStemFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f JapaneseKatakanaStemFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		if !token.Keyword && isKatakana(token.Term) {
+			runes := []rune(token.Term)
+			for len(runes) > f.minLength && runes[len(runes)-1] == 'ー' {
+				runes = runes[:len(runes)-1]
+			}
+			token.Term = string(runes)
+		}
+		return token, true
+	})
+}
+
+// 長音記号を含むカタカナのみからなるか
+func isKatakana(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.Is(unicode.Katakana, r) && r != 'ー' {
+			return false
+		}
+	}
+	return true
 }
 
 type RomajiReadingformFilter struct{}
@@ -72,11 +422,14 @@ func NewRomajiReadingformFilter() RomajiReadingformFilter {
 }
 
 func (f RomajiReadingformFilter) Filter(tokenStream TokenStream) TokenStream {
-	for i, token := range tokenStream.Tokens {
-		tokenStream.Tokens[i].Term = jaconv.ToHebon(jaconv.KatakanaToHiragana(token.Kana))
-	}
-	return tokenStream
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
 
+func (f RomajiReadingformFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		token.Term = jaconv.ToHebon(jaconv.KatakanaToHiragana(token.Kana))
+		return token, true
+	})
 }
 
 type KanaReadingformFilter struct{}
@@ -86,9 +439,537 @@ func NewKanaReadingformFilter() KanaReadingformFilter {
 }
 
 func (f KanaReadingformFilter) Filter(tokenStream TokenStream) TokenStream {
-	// カナはTokenizerで既に変換されているのでTokenStreamの変数にセットする
-	for i := range tokenStream.Tokens {
-		tokenStream.Tokens[i].Term = tokenStream.Tokens[i].Kana
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f KanaReadingformFilter) FilterIterator(it TokenIterator) TokenIterator {
+	// カナはTokenizerで既に変換されているのでトークンの語句にセットする
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		token.Term = token.Kana
+		return token, true
+	})
+}
+
+// 全角英数字を半角に、半角カタカナを全角に揃える
+// 半角の濁点・半濁点は直前のカタカナと結合する(ｶﾞ→ガ)
+type WidthFoldingFilter struct{}
+
+func NewWidthFoldingFilter() WidthFoldingFilter {
+	return WidthFoldingFilter{}
+}
+
+var halfwidthSoundMarkReplacer = strings.NewReplacer("\uff9e", "\u3099", "\uff9f", "\u309a")
+
+func (f WidthFoldingFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f WidthFoldingFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		token.Term = norm.NFC.String(width.Fold.String(halfwidthSoundMarkReplacer.Replace(token.Term)))
+		return token, true
+	})
+}
+
+// 各トークンを長さmin以上max以下(ルーン数)の接頭辞または接尾辞のトークンに置き換える
+// 同じトークンから作ったトークンは元のトークンと同じ位置に重ね、オフセットは元のトークンのものを引き継ぐ
+// minより短いトークンは取り除く
+type EdgeNgramFilter struct {
+	min  int
+	max  int
+	side EdgeNgramSide
+}
+
+func NewEdgeNgramFilter(min, max int, side EdgeNgramSide) EdgeNgramFilter {
+	return EdgeNgramFilter{
+		min:  min,
+		max:  max,
+		side: side,
+	}
+}
+
+func (f EdgeNgramFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f EdgeNgramFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newExpandTokenIterator(it, func(token Token) []Token {
+		runes := []rune(token.Term)
+		lengths := edgeNgramLengths(len(runes), f.min, f.max)
+		r := make([]Token, len(lengths))
+		for i, l := range lengths {
+			gram := token
+			gram.Term = string(runes[:l])
+			if f.side == EdgeNgramBack {
+				gram.Term = string(runes[len(runes)-l:])
+			}
+			if i > 0 {
+				gram.PositionIncrement = 0
+			}
+			r[i] = gram
+		}
+		return r
+	})
+}
+
+// 連続するmin個以上max個以下のトークンをseparatorで繋げたシングル(単語N-gram)を追加する
+// シングルは先頭のトークンと同じ位置に重ね、位置の長さを繋げたトークンの数とする
+// 重なったトークンや空いた位置はまたがない
+// よく出る語句の並びを一つのトークンとしてインデックスし、フレーズ検索で使う
+type ShingleFilter struct {
+	min            int
+	max            int
+	separator      string
+	outputUnigrams bool
+}
+
+// minが2より小さい時は2とする
+// outputUnigramsがfalseなら元のトークンを取り除く
+func NewShingleFilter(min, max int, separator string, outputUnigrams bool) ShingleFilter {
+	if min < 2 {
+		min = 2
+	}
+	return ShingleFilter{
+		min:            min,
+		max:            max,
+		separator:      separator,
+		outputUnigrams: outputUnigrams,
+	}
+}
+
+func (f ShingleFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+// 各トークンの後に続くmax-1個のトークンだけを先読みする
+func (f ShingleFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return &shingleTokenIterator{filter: f, source: it}
+}
+
+type shingleTokenIterator struct {
+	filter    ShingleFilter
+	source    TokenIterator
+	window    []Token // 次に処理するトークンと、その後に続く先読みしたトークン
+	exhausted bool
+	pending   []Token
+	token     Token
+	skipped   int
+}
+
+func (it *shingleTokenIterator) Next() bool {
+	for len(it.pending) == 0 {
+		for !it.exhausted && (len(it.window) < it.filter.max || len(it.window) == 0) {
+			if !it.source.Next() {
+				it.exhausted = true
+				break
+			}
+			it.window = append(it.window, it.source.Token())
+		}
+		if len(it.window) == 0 {
+			return false
+		}
+		increment := it.window[0].PositionIncrement + it.skipped
+		it.pending = it.filter.shingles(it.window, increment)
+		it.skipped = 0
+		if len(it.pending) == 0 {
+			it.skipped = increment
+		}
+		it.window = append(it.window[:0], it.window[1:]...)
+	}
+	it.token, it.pending = it.pending[0], it.pending[1:]
+	return true
+}
+
+func (it *shingleTokenIterator) Token() Token {
+	return it.token
+}
+
+// 先頭のトークンと、先頭のトークンから始まるシングルを返す
+// 最初に出力するトークンの位置の増分はincrementにする
+func (f ShingleFilter) shingles(tokens []Token, increment int) []Token {
+	token := tokens[0]
+	r := make([]Token, 0)
+	if f.outputUnigrams {
+		unigram := token
+		unigram.PositionIncrement = increment
+		r = append(r, unigram)
+	}
+	terms := []string{token.Term}
+	for j := 1; j < len(tokens) && len(terms) < f.max; j++ {
+		if tokens[j].PositionIncrement != 1 {
+			break
+		}
+		terms = append(terms, tokens[j].Term)
+		if len(terms) < f.min {
+			continue
+		}
+		shingle := NewToken(strings.Join(terms, f.separator), setOffset(token.Start, tokens[j].End), setType(TokenTypeShingle), setPositionIncrement(0), setPositionLength(len(terms)))
+		if len(r) == 0 {
+			shingle.PositionIncrement = increment
+		}
+		r = append(r, shingle)
+	}
+	return r
+}
+
+// アクセント記号等を取り除き、対応するASCII文字に置き換える("café"->"cafe")
+// ASCII文字に置き換えられない文字(かな、漢字等)は変更しない
+type ASCIIFoldingFilter struct{}
+
+func NewASCIIFoldingFilter() ASCIIFoldingFilter {
+	return ASCIIFoldingFilter{}
+}
+
+// 分解してもASCII文字にならない文字
+var asciiFoldings = map[rune]string{
+	'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss", 'Ø': "O", 'ø': "o",
+	'Đ': "D", 'đ': "d", 'Ð': "D", 'ð': "d", 'Ł': "L", 'ł': "l", 'Þ': "TH", 'þ': "th",
+	'ı': "i", 'Ħ': "H", 'ħ': "h", 'Ŀ': "L", 'ŀ': "l", 'Ŧ': "T", 'ŧ': "t",
+	'‘': "'", '’': "'", '‚': "'", '“': "\"", '”': "\"", '„': "\"", '–': "-", '—': "-",
+}
+
+func (f ASCIIFoldingFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f ASCIIFoldingFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		token.Term = foldToASCII(token.Term)
+		return token, true
+	})
+}
+
+func foldToASCII(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		if c < utf8.RuneSelf {
+			b.WriteRune(c)
+			continue
+		}
+		if folded, ok := asciiFoldings[c]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		// 基底文字がASCII文字で、残りが結合文字なら基底文字にする
+		d := []rune(norm.NFD.String(string(c)))
+		if d[0] < utf8.RuneSelf && isAllMarks(d[1:]) {
+			b.WriteRune(d[0])
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func isAllMarks(rs []rune) bool {
+	for _, r := range rs {
+		if !unicode.Is(unicode.Mn, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// 長さ(ルーン数)がmin以上max以下のトークンだけを残す
+// maxが0以下なら長さの上限はない
+type LengthFilter struct {
+	min int
+	max int
+}
+
+func NewLengthFilter(min, max int) LengthFilter {
+	return LengthFilter{
+		min: min,
+		max: max,
+	}
+}
+
+// 取り除いたトークンの位置の増分は次のトークンに加算する
+func (f LengthFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f LengthFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		n := utf8.RuneCountInString(token.Term)
+		return token, n >= f.min && (f.max <= 0 || n <= f.max)
+	})
+}
+
+// 重複するトークンを取り除き、最初のトークンだけを残す
+// onlySamePositionがtrueなら同じ位置に重なったトークンの重複だけを取り除く
+type UniqueFilter struct {
+	onlySamePosition bool
+}
+
+func NewUniqueFilter(onlySamePosition bool) UniqueFilter {
+	return UniqueFilter{
+		onlySamePosition: onlySamePosition,
+	}
+}
+
+// 取り除いたトークンの位置の増分は次のトークンに加算する
+func (f UniqueFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+// onlySamePositionがtrueなら、覚えておく語句は現在の位置のものだけになる
+func (f UniqueFilter) FilterIterator(it TokenIterator) TokenIterator {
+	seen := make(map[string]struct{})
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		if f.onlySamePosition && token.PositionIncrement > 0 {
+			seen = make(map[string]struct{})
+		}
+		if _, ok := seen[token.Term]; ok {
+			return token, false
+		}
+		seen[token.Term] = struct{}{}
+		return token, true
+	})
+}
+
+// トークンの前後の空白を取り除く
+// オフセットが語句と同じ長さを指していれば、取り除いた分だけオフセットを詰める
+// 空になったトークンは取り除き、位置の増分は次のトークンに加算する
+type TrimFilter struct{}
+
+func NewTrimFilter() TrimFilter {
+	return TrimFilter{}
+}
+
+func (f TrimFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f TrimFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newMapTokenIterator(it, func(token Token) (Token, bool) {
+		trimmed := strings.TrimLeftFunc(token.Term, unicode.IsSpace)
+		leading := len(token.Term) - len(trimmed)
+		trimmed = strings.TrimRightFunc(trimmed, unicode.IsSpace)
+		if trimmed == "" {
+			return token, false
+		}
+		if token.End-token.Start == len(token.Term) {
+			token.Start += leading
+			token.End = token.Start + len(trimmed)
+		}
+		token.Term = trimmed
+		return token, true
+	})
+}
+
+// 区切り文字、大文字と小文字の変わり目、文字と数字の変わり目でトークンを分割する("PowerShot-SD500"->"Power","Shot","SD","500")
+// 分割したトークンは連続する位置に置き、連結したトークンと元のトークンは先頭と同じ位置に重ねて、位置の長さを覆うトークンの数とする
+// オフセットが語句と同じ長さを指していれば、分割したトークンのオフセットは元の文字列中の位置を指す
+type WordDelimiterFilter struct {
+	splitOnCaseChange bool
+	splitOnNumerics   bool
+	catenateWords     bool
+	catenateNumbers   bool
+	catenateAll       bool
+	preserveOriginal  bool
+}
+
+type WordDelimiterOption func(*WordDelimiterFilter)
+
+// 大文字と小文字の変わり目で分割するか(デフォルトはtrue)
+func WithSplitOnCaseChange(split bool) WordDelimiterOption {
+	return func(f *WordDelimiterFilter) {
+		f.splitOnCaseChange = split
+	}
+}
+
+// 文字と数字の変わり目で分割するか(デフォルトはtrue)
+func WithSplitOnNumerics(split bool) WordDelimiterOption {
+	return func(f *WordDelimiterFilter) {
+		f.splitOnNumerics = split
+	}
+}
+
+// 連続する文字の部分を連結したトークンを追加する("wi-fi"->"wifi")
+func WithCatenateWords() WordDelimiterOption {
+	return func(f *WordDelimiterFilter) {
+		f.catenateWords = true
+	}
+}
+
+// 連続する数字の部分を連結したトークンを追加する("500-42"->"50042")
+func WithCatenateNumbers() WordDelimiterOption {
+	return func(f *WordDelimiterFilter) {
+		f.catenateNumbers = true
+	}
+}
+
+// 全ての部分を連結したトークンを追加する("wi-fi-4000"->"wifi4000")
+func WithCatenateAll() WordDelimiterOption {
+	return func(f *WordDelimiterFilter) {
+		f.catenateAll = true
+	}
+}
+
+// 分割した時に元のトークンも残す
+func WithPreserveOriginal() WordDelimiterOption {
+	return func(f *WordDelimiterFilter) {
+		f.preserveOriginal = true
+	}
+}
+
+func NewWordDelimiterFilter(options ...WordDelimiterOption) WordDelimiterFilter {
+	f := WordDelimiterFilter{
+		splitOnCaseChange: true,
+		splitOnNumerics:   true,
+	}
+	for _, option := range options {
+		option(&f)
+	}
+	return f
+}
+
+// 語句中の部分のバイト位置
+type wordPart struct {
+	start  int
+	end    int
+	number bool
+}
+
+// 文字の種類
+type wordClass int
+
+const (
+	wordClassDelimiter wordClass = iota
+	wordClassLower               // 小文字と大文字小文字の区別がない文字
+	wordClassUpper
+	wordClassDigit
+)
+
+func classifyWordRune(r rune) wordClass {
+	switch {
+	case unicode.IsUpper(r):
+		return wordClassUpper
+	case unicode.IsLetter(r):
+		return wordClassLower
+	case unicode.IsDigit(r):
+		return wordClassDigit
+	}
+	return wordClassDelimiter
+}
+
+// 取り除いたトークンの位置の増分は次のトークンに加算する
+func (f WordDelimiterFilter) Filter(tokenStream TokenStream) TokenStream {
+	return CollectTokens(f.FilterIterator(tokenStream.Iterator()))
+}
+
+func (f WordDelimiterFilter) FilterIterator(it TokenIterator) TokenIterator {
+	return newExpandTokenIterator(it, f.delimit)
+}
+
+// トークンを分割したトークンを返す
+// 部分がなく元のトークンを残さない時は空のスライスを返す
+func (f WordDelimiterFilter) delimit(token Token) []Token {
+	parts := f.split(token.Term)
+	if len(parts) == 0 && !f.preserveOriginal {
+		return nil
+	}
+	if len(parts) == 0 || (len(parts) == 1 && parts[0].start == 0 && parts[0].end == len(token.Term)) {
+		return []Token{token}
+	}
+	r := make([]Token, 0, len(parts)+1)
+	increment := token.PositionIncrement
+	if f.preserveOriginal {
+		original := token
+		setPositionLength(len(parts))(&original)
+		r = append(r, original)
+		increment = 0
+	}
+	for i := range parts {
+		if i > 0 {
+			increment = 1
+		}
+		for _, end := range f.catenations(parts, i) {
+			catenated := wordPartToken(token, parts[i:end])
+			// 区切り文字がなく元のトークンと同じ語句になる時は、元のトークンを残していれば重複するので追加しない
+			if f.preserveOriginal && catenated.Term == token.Term {
+				continue
+			}
+			catenated.PositionIncrement = increment
+			r = append(r, catenated)
+			increment = 0
+		}
+		part := wordPartToken(token, parts[i:i+1])
+		part.PositionIncrement = increment
+		r = append(r, part)
+	}
+	return r
+}
+
+func (f WordDelimiterFilter) split(term string) []wordPart {
+	parts := make([]wordPart, 0)
+	start := -1
+	// 直前の2文字の種類と、直前の文字のバイト位置
+	prev, prevPrev, prevPos := wordClassDelimiter, wordClassDelimiter, 0
+	closePart := func(end int) {
+		if start >= 0 {
+			c, _ := utf8.DecodeRuneInString(term[start:])
+			parts = append(parts, wordPart{start: start, end: end, number: classifyWordRune(c) == wordClassDigit})
+		}
+		start = -1
+	}
+	for pos, c := range term {
+		class := classifyWordRune(c)
+		switch {
+		case class == wordClassDelimiter:
+			closePart(pos)
+		case start < 0:
+			start = pos
+		case f.splitOnNumerics && (prev == wordClassDigit) != (class == wordClassDigit):
+			closePart(pos)
+			start = pos
+		case f.splitOnCaseChange && prev == wordClassLower && class == wordClassUpper:
+			closePart(pos)
+			start = pos
+		case f.splitOnCaseChange && prevPrev == wordClassUpper && prev == wordClassUpper && class == wordClassLower && start < prevPos:
+			// 大文字の連続の後に小文字が続く時は、最後の大文字から新しい部分にする("HTTPResponse"->"HTTP","Response")
+			closePart(prevPos)
+			start = prevPos
+		}
+		prevPrev, prev, prevPos = prev, class, pos
+	}
+	closePart(len(term))
+	return parts
+}
+
+// i番目の部分から始まる連結したトークンの終わり(含まない)を、長い順に返す
+func (f WordDelimiterFilter) catenations(parts []wordPart, i int) []int {
+	ends := make([]int, 0)
+	if f.catenateAll && i == 0 && len(parts) > 1 {
+		ends = append(ends, len(parts))
+	}
+	if (parts[i].number && !f.catenateNumbers) || (!parts[i].number && !f.catenateWords) {
+		return ends
+	}
+	if i > 0 && parts[i-1].number == parts[i].number {
+		return ends
+	}
+	end := i + 1
+	for end < len(parts) && parts[end].number == parts[i].number {
+		end++
+	}
+	if end-i > 1 && (len(ends) == 0 || ends[0] != end || i != 0) {
+		ends = append(ends, end)
+	}
+	return ends
+}
+
+// 連続する部分を連結したトークン
+func wordPartToken(token Token, parts []wordPart) Token {
+	var b strings.Builder
+	for _, p := range parts {
+		b.WriteString(token.Term[p.start:p.end])
+	}
+	if token.End-token.Start == len(token.Term) {
+		token.Start, token.End = token.Start+parts[0].start, token.Start+parts[len(parts)-1].end
 	}
-	return tokenStream
+	token.Term = b.String()
+	setPositionLength(len(parts))(&token)
+	return token
 }
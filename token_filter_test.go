@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestLowercaseFilter_Filter(t *testing.T) {
@@ -34,8 +36,8 @@ func TestStopWordFilter_Filter(t *testing.T) {
 	}{
 		{
 			stopWords:   []string{"hoge"},
-			tokenStream: TokenStream{Tokens: []Token{{Term: "hoge"}, {Term: "fuga"}, {Term: "piyo"}}},
-			want:        TokenStream{Tokens: []Token{{Term: "fuga"}, {Term: "piyo"}}},
+			tokenStream: TokenStream{Tokens: []Token{{Term: "hoge", PositionIncrement: 1}, {Term: "fuga", PositionIncrement: 1}, {Term: "piyo", PositionIncrement: 1}}},
+			want:        TokenStream{Tokens: []Token{{Term: "fuga", PositionIncrement: 2}, {Term: "piyo", PositionIncrement: 1}}},
 		},
 	}
 	for _, tt := range tests {
@@ -110,3 +112,598 @@ func TestKanaReadingformFilter_Filter(t *testing.T) {
 		})
 	}
 }
+
+func TestStopWordFilter_PositionIncrement(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{NewToken("the"), NewToken("quick"), NewToken("a"), NewToken("the"), NewToken("fox")})
+	want := TokenStream{Tokens: []Token{NewToken("quick", setPositionIncrement(2)), NewToken("fox", setPositionIncrement(3))}}
+
+	got := NewStopWordFilter([]string{"the", "a"}).Filter(tokenStream)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StopWordFilter.Filter() = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(got.Positions(), []uint64{1, 4}) {
+		t.Errorf("TokenStream.Positions() = %v, want %v", got.Positions(), []uint64{1, 4})
+	}
+}
+
+func TestKeywordMarkerFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{NewToken("running"), NewToken("jumping")})
+	want := TokenStream{Tokens: []Token{NewToken("running", setKeyword(true)), NewToken("jump")}}
+
+	got := NewStemmerFilter().Filter(NewKeywordMarkerFilter([]string{"running"}).Filter(tokenStream))
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StemmerFilter.Filter() = %v, want %v", got, want)
+	}
+}
+
+func TestSnowballStemmerFilter_Filter(t *testing.T) {
+	tests := []struct {
+		language    Language
+		tokenStream TokenStream
+		want        TokenStream
+	}{
+		{
+			language:    English,
+			tokenStream: NewTokenStream([]Token{NewToken("pens"), NewToken("running")}),
+			want:        NewTokenStream([]Token{NewToken("pen"), NewToken("run")}),
+		},
+		{
+			language:    French,
+			tokenStream: NewTokenStream([]Token{NewToken("continuellement"), NewToken("chats")}),
+			want:        NewTokenStream([]Token{NewToken("continuel"), NewToken("chat")}),
+		},
+		{
+			language:    Spanish,
+			tokenStream: NewTokenStream([]Token{NewToken("bibliotecas")}),
+			want:        NewTokenStream([]Token{NewToken("bibliotec")}),
+		},
+		{
+			language:    Russian,
+			tokenStream: NewTokenStream([]Token{NewToken("книги")}),
+			want:        NewTokenStream([]Token{NewToken("книг")}),
+		},
+		{
+			language:    Swedish,
+			tokenStream: NewTokenStream([]Token{NewToken("flickorna")}),
+			want:        NewTokenStream([]Token{NewToken("flick")}),
+		},
+		{
+			language:    Language("klingon"),
+			tokenStream: NewTokenStream([]Token{NewToken("chats")}),
+			want:        NewTokenStream([]Token{NewToken("chats")}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("language = %v, tokenStream = %v, want = %v", tt.language, tt.tokenStream, tt.want), func(t *testing.T) {
+			got := NewSnowballStemmerFilter(tt.language).Filter(tt.tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDefaultStopWords(t *testing.T) {
+	for _, language := range StemmerLanguages() {
+		if len(DefaultStopWords(language)) == 0 {
+			t.Errorf("DefaultStopWords(%v) is empty", language)
+		}
+	}
+	if got := DefaultStopWords(Language("klingon")); got != nil {
+		t.Errorf("DefaultStopWords() = %v, want nil", got)
+	}
+
+	tokenStream := NewTokenStream([]Token{NewToken("le"), NewToken("chats"), NewToken("de"), NewToken("paris")})
+	want := NewTokenStream([]Token{NewToken("chat", setPositionIncrement(2)), NewToken("paris", setPositionIncrement(2))})
+
+	got := NewSnowballStemmerFilter(French).Filter(NewStopWordFilter(DefaultStopWords(French)).Filter(tokenStream))
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestWidthFoldingFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{NewToken("ＧＯ１", setOffset(0, 9)), NewToken("ｶﾞｯﾂﾎﾟｰｽﾞ", setOffset(10, 37))})
+	want := TokenStream{Tokens: []Token{NewToken("GO1", setOffset(0, 9)), NewToken("ガッツポーズ", setOffset(10, 37))}}
+
+	got := NewWidthFoldingFilter().Filter(tokenStream)
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestEdgeNgramFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{NewToken("go", setOffset(0, 2)), NewToken("a", setOffset(3, 4)), NewToken("白馬村", setOffset(5, 14))})
+	tests := []struct {
+		side EdgeNgramSide
+		want TokenStream
+	}{
+		{
+			side: EdgeNgramFront,
+			want: TokenStream{Tokens: []Token{
+				NewToken("go", setOffset(0, 2)),
+				NewToken("白馬", setOffset(5, 14), setPositionIncrement(2)),
+				NewToken("白馬村", setOffset(5, 14), setPositionIncrement(0)),
+			}},
+		},
+		{
+			side: EdgeNgramBack,
+			want: TokenStream{Tokens: []Token{
+				NewToken("go", setOffset(0, 2)),
+				NewToken("馬村", setOffset(5, 14), setPositionIncrement(2)),
+				NewToken("白馬村", setOffset(5, 14), setPositionIncrement(0)),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("side = %v", tt.side), func(t *testing.T) {
+			got := NewEdgeNgramFilter(2, 3, tt.side).Filter(tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+			if diff := cmp.Diff(got.Positions(), []uint64{0, 2, 2}); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestShingleFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("please", setOffset(0, 6)),
+		NewToken("divide", setOffset(7, 13)),
+		NewToken("sentence", setOffset(19, 27), setPositionIncrement(2)),
+		NewToken("into", setOffset(28, 32)),
+		NewToken("shingles", setOffset(33, 41)),
+	})
+	tests := []struct {
+		min            int
+		max            int
+		separator      string
+		outputUnigrams bool
+		want           TokenStream
+	}{
+		{
+			min:            2,
+			max:            2,
+			separator:      " ",
+			outputUnigrams: true,
+			want: NewTokenStream([]Token{
+				NewToken("please", setOffset(0, 6)),
+				NewToken("please divide", setOffset(0, 13), setType(TokenTypeShingle), setPositionIncrement(0), setPositionLength(2)),
+				NewToken("divide", setOffset(7, 13)),
+				NewToken("sentence", setOffset(19, 27), setPositionIncrement(2)),
+				NewToken("sentence into", setOffset(19, 32), setType(TokenTypeShingle), setPositionIncrement(0), setPositionLength(2)),
+				NewToken("into", setOffset(28, 32)),
+				NewToken("into shingles", setOffset(28, 41), setType(TokenTypeShingle), setPositionIncrement(0), setPositionLength(2)),
+				NewToken("shingles", setOffset(33, 41)),
+			}),
+		},
+		{
+			min:            1,
+			max:            3,
+			separator:      "_",
+			outputUnigrams: false,
+			want: NewTokenStream([]Token{
+				NewToken("please_divide", setOffset(0, 13), setType(TokenTypeShingle), setPositionLength(2)),
+				NewToken("sentence_into", setOffset(19, 32), setType(TokenTypeShingle), setPositionIncrement(3), setPositionLength(2)),
+				NewToken("sentence_into_shingles", setOffset(19, 41), setType(TokenTypeShingle), setPositionIncrement(0), setPositionLength(3)),
+				NewToken("into_shingles", setOffset(28, 41), setType(TokenTypeShingle), setPositionLength(2)),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("min = %v, max = %v, separator = %v, outputUnigrams = %v", tt.min, tt.max, tt.separator, tt.outputUnigrams), func(t *testing.T) {
+			got := NewShingleFilter(tt.min, tt.max, tt.separator, tt.outputUnigrams).Filter(tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestASCIIFoldingFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("café", setKana("カフェ"), setOffset(0, 5)),
+		NewToken("Straße", setOffset(6, 13)),
+		NewToken("Ærøskøbing"),
+		NewToken("naïve"),
+		NewToken("ガッツ"),
+		NewToken("東京"),
+	})
+	want := NewTokenStream([]Token{
+		NewToken("cafe", setKana("カフェ"), setOffset(0, 5)),
+		NewToken("Strasse", setOffset(6, 13)),
+		NewToken("AEroskobing"),
+		NewToken("naive"),
+		NewToken("ガッツ"),
+		NewToken("東京"),
+	})
+
+	got := NewASCIIFoldingFilter().Filter(tokenStream)
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestLengthFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("a"),
+		NewToken("東京", setKana("トウキョウ")),
+		NewToken("x"),
+		NewToken("y"),
+		NewToken("elephant"),
+		NewToken("fox"),
+	})
+	tests := []struct {
+		min  int
+		max  int
+		want TokenStream
+	}{
+		{
+			min: 2,
+			max: 0,
+			want: NewTokenStream([]Token{
+				NewToken("東京", setKana("トウキョウ"), setPositionIncrement(2)),
+				NewToken("elephant", setPositionIncrement(3)),
+				NewToken("fox"),
+			}),
+		},
+		{
+			min: 2,
+			max: 3,
+			want: NewTokenStream([]Token{
+				NewToken("東京", setKana("トウキョウ"), setPositionIncrement(2)),
+				NewToken("fox", setPositionIncrement(4)),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("min = %v, max = %v, want = %v", tt.min, tt.max, tt.want), func(t *testing.T) {
+			got := NewLengthFilter(tt.min, tt.max).Filter(tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUniqueFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("run", setOffset(0, 3)),
+		NewToken("run", setOffset(0, 3), setPositionIncrement(0)),
+		NewToken("fast", setKana("ファスト"), setOffset(4, 8)),
+		NewToken("run", setOffset(9, 12)),
+		NewToken("home", setOffset(13, 17)),
+	})
+	tests := []struct {
+		onlySamePosition bool
+		want             TokenStream
+	}{
+		{
+			onlySamePosition: false,
+			want: NewTokenStream([]Token{
+				NewToken("run", setOffset(0, 3)),
+				NewToken("fast", setKana("ファスト"), setOffset(4, 8)),
+				NewToken("home", setOffset(13, 17), setPositionIncrement(2)),
+			}),
+		},
+		{
+			onlySamePosition: true,
+			want: NewTokenStream([]Token{
+				NewToken("run", setOffset(0, 3)),
+				NewToken("fast", setKana("ファスト"), setOffset(4, 8)),
+				NewToken("run", setOffset(9, 12)),
+				NewToken("home", setOffset(13, 17)),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("onlySamePosition = %v, want = %v", tt.onlySamePosition, tt.want), func(t *testing.T) {
+			got := NewUniqueFilter(tt.onlySamePosition).Filter(tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTrimFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken(" foo ", setKana("フー"), setOffset(0, 5)),
+		NewToken("  ", setOffset(5, 7)),
+		NewToken("\tbar", setOffset(7, 11)),
+		NewToken(" 東京", setOffset(11, 13)),
+	})
+	want := NewTokenStream([]Token{
+		NewToken("foo", setKana("フー"), setOffset(1, 4)),
+		NewToken("bar", setOffset(8, 11), setPositionIncrement(2)),
+		NewToken("東京", setOffset(11, 13)),
+	})
+
+	got := NewTrimFilter().Filter(tokenStream)
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestWordDelimiterFilter_Filter(t *testing.T) {
+	tests := []struct {
+		options     []WordDelimiterOption
+		tokenStream TokenStream
+		want        TokenStream
+	}{
+		{
+			tokenStream: NewTokenStream([]Token{NewToken("PowerShot-SD500", setOffset(0, 15)), NewToken("zoom", setOffset(16, 20))}),
+			want: NewTokenStream([]Token{
+				NewToken("Power", setOffset(0, 5)),
+				NewToken("Shot", setOffset(5, 9)),
+				NewToken("SD", setOffset(10, 12)),
+				NewToken("500", setOffset(12, 15)),
+				NewToken("zoom", setOffset(16, 20)),
+			}),
+		},
+		{
+			tokenStream: NewTokenStream([]Token{NewToken("getHTTPResponse", setOffset(0, 15))}),
+			want: NewTokenStream([]Token{
+				NewToken("get", setOffset(0, 3)),
+				NewToken("HTTP", setOffset(3, 7)),
+				NewToken("Response", setOffset(7, 15)),
+			}),
+		},
+		{
+			options:     []WordDelimiterOption{WithSplitOnCaseChange(false), WithSplitOnNumerics(false)},
+			tokenStream: NewTokenStream([]Token{NewToken("PowerShot-SD500", setOffset(0, 15))}),
+			want: NewTokenStream([]Token{
+				NewToken("PowerShot", setOffset(0, 9)),
+				NewToken("SD500", setOffset(10, 15)),
+			}),
+		},
+		{
+			options:     []WordDelimiterOption{WithCatenateWords(), WithCatenateNumbers(), WithCatenateAll(), WithPreserveOriginal()},
+			tokenStream: NewTokenStream([]Token{NewToken("wi-fi-4000-12", setOffset(0, 13))}),
+			want: NewTokenStream([]Token{
+				NewToken("wi-fi-4000-12", setOffset(0, 13), setPositionLength(4)),
+				NewToken("wifi400012", setOffset(0, 13), setPositionIncrement(0), setPositionLength(4)),
+				NewToken("wifi", setOffset(0, 5), setPositionIncrement(0), setPositionLength(2)),
+				NewToken("wi", setOffset(0, 2), setPositionIncrement(0)),
+				NewToken("fi", setOffset(3, 5)),
+				NewToken("400012", setOffset(6, 13), setPositionLength(2)),
+				NewToken("4000", setOffset(6, 10), setPositionIncrement(0)),
+				NewToken("12", setOffset(11, 13)),
+			}),
+		},
+		{
+			options:     []WordDelimiterOption{WithCatenateWords(), WithCatenateAll(), WithPreserveOriginal()},
+			tokenStream: NewTokenStream([]Token{NewToken("getHTTPResponse", setOffset(0, 15))}),
+			want: NewTokenStream([]Token{
+				NewToken("getHTTPResponse", setOffset(0, 15), setPositionLength(3)),
+				NewToken("get", setOffset(0, 3), setPositionIncrement(0)),
+				NewToken("HTTP", setOffset(3, 7)),
+				NewToken("Response", setOffset(7, 15)),
+			}),
+		},
+		{
+			options:     []WordDelimiterOption{WithCatenateWords(), WithCatenateAll()},
+			tokenStream: NewTokenStream([]Token{NewToken("Wi-Fi", setKana("ワイファイ"))}),
+			want: NewTokenStream([]Token{
+				NewToken("WiFi", setKana("ワイファイ"), setPositionLength(2)),
+				NewToken("Wi", setKana("ワイファイ"), setPositionIncrement(0)),
+				NewToken("Fi", setKana("ワイファイ")),
+			}),
+		},
+		{
+			tokenStream: NewTokenStream([]Token{NewToken("--"), NewToken("stalefish"), NewToken("_x_")}),
+			want: NewTokenStream([]Token{
+				NewToken("stalefish", setPositionIncrement(2)),
+				NewToken("x"),
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("tokenStream = %v, want = %v", tt.tokenStream, tt.want), func(t *testing.T) {
+			got := NewWordDelimiterFilter(tt.options...).Filter(tt.tokenStream)
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJapanesePOSStopFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("白馬", setPartOfSpeech("名詞-一般")),
+		NewToken("へ", setPartOfSpeech("助詞-格助詞-一般")),
+		NewToken("滑り", setPartOfSpeech("動詞-自立")),
+		NewToken("に", setPartOfSpeech("助詞-格助詞-一般")),
+		NewToken("いき", setPartOfSpeech("動詞-自立")),
+		NewToken("たい", setPartOfSpeech("助動詞")),
+		NewToken("助詞", setPartOfSpeech("名詞-一般")),
+	})
+	tests := []struct {
+		stopTags []string
+		want     []string
+	}{
+		{stopTags: DefaultJapanesePOSStopTags, want: []string{"白馬", "滑り", "いき", "助詞"}},
+		{stopTags: []string{"助詞-格助詞"}, want: []string{"白馬", "滑り", "いき", "たい", "助詞"}},
+		{stopTags: []string{"助"}, want: []string{"白馬", "へ", "滑り", "に", "いき", "たい", "助詞"}},
+		{stopTags: []string{}, want: []string{"白馬", "へ", "滑り", "に", "いき", "たい", "助詞"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("stopTags = %v, want = %v", tt.stopTags, tt.want), func(t *testing.T) {
+			got := NewJapanesePOSStopFilter(tt.stopTags).Filter(tokenStream)
+			if diff := cmp.Diff(got.Terms(), tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestJapanesePOSStopFilter_PositionIncrement(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("今日", setPartOfSpeech("名詞-副詞可能")),
+		NewToken("は", setPartOfSpeech("助詞-係助詞")),
+		NewToken("天気", setPartOfSpeech("名詞-一般")),
+	})
+	got := NewJapanesePOSStopFilter(DefaultJapanesePOSStopTags).Filter(tokenStream)
+	if diff := cmp.Diff(got.Positions(), []uint64{0, 2}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestJapaneseBaseFormFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("滑り", setKana("スベリ"), setPartOfSpeech("動詞-自立"), setBaseForm("滑る"), setInflection("五段・ラ行", "連用形")),
+		NewToken("いき", setBaseForm("いく"), setInflection("五段・カ行促音便", "連用形")),
+		NewToken("たかっ", setBaseForm("たい"), setInflection("特殊・タイ", "連用タ接続"), setKeyword(true)),
+		// 活用しない名詞は辞書の原形が異なっても置き換えない
+		NewToken("バレイ", setPartOfSpeech("名詞-一般"), setBaseForm("馬齢")),
+		NewToken("white"),
+	})
+	want := TokenStream{Tokens: []Token{
+		NewToken("滑る", setKana("スベリ"), setPartOfSpeech("動詞-自立"), setBaseForm("滑る"), setInflection("五段・ラ行", "連用形")),
+		NewToken("いく", setBaseForm("いく"), setInflection("五段・カ行促音便", "連用形")),
+		NewToken("たかっ", setBaseForm("たい"), setInflection("特殊・タイ", "連用タ接続"), setKeyword(true)),
+		NewToken("バレイ", setPartOfSpeech("名詞-一般"), setBaseForm("馬齢")),
+		NewToken("white"),
+	}}
+
+	got := NewJapaneseBaseFormFilter().Filter(tokenStream)
+
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestJapaneseKatakanaStemFilter_Filter(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{
+		NewToken("コンピューター"),
+		NewToken("コンピュータ"),
+		NewToken("メーカー"),
+		NewToken("パーティーー"),
+		NewToken("サーバー", setKeyword(true)),
+		NewToken("ゲームー"),
+		NewToken("白馬ー"),
+	})
+	want := []string{"コンピュータ", "コンピュータ", "メーカー", "パーティ", "サーバー", "ゲームー", "白馬ー"}
+
+	got := NewJapaneseKatakanaStemFilter(DefaultKatakanaStemMinLength).Filter(tokenStream)
+
+	if diff := cmp.Diff(got.Terms(), want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+// どの順序でフィルタを適用しても、語句以外の属性は引き継がれる
+func TestTokenFilter_PreserveAttributes(t *testing.T) {
+	filters := []TokenFilter{
+		NewLowercaseFilter(),
+		NewStemmerFilter(),
+		NewStopWordFilter([]string{"の"}),
+		NewKeywordMarkerFilter([]string{"スキー"}),
+	}
+	tokenStream := NewTokenStream([]Token{
+		NewToken("Hakuba", setKana("ハクバ"), setPartOfSpeech("名詞"), setOffset(0, 6), setType(TokenTypeMorpheme)),
+		NewToken("の", setKana("ノ"), setPartOfSpeech("助詞"), setOffset(6, 9), setType(TokenTypeMorpheme)),
+		NewToken("スキー", setKana("スキー"), setPartOfSpeech("名詞"), setOffset(9, 18), setType(TokenTypeMorpheme)),
+	})
+	wantKana := TokenStream{Tokens: []Token{
+		NewToken("ハクバ", setKana("ハクバ"), setPartOfSpeech("名詞"), setOffset(0, 6), setType(TokenTypeMorpheme)),
+		NewToken("スキー", setKana("スキー"), setPartOfSpeech("名詞"), setOffset(9, 18), setType(TokenTypeMorpheme), setPositionIncrement(2), setKeyword(true)),
+	}}
+	wantRomaji := TokenStream{Tokens: []Token{
+		NewToken("hakuba", setKana("ハクバ"), setPartOfSpeech("名詞"), setOffset(0, 6), setType(TokenTypeMorpheme)),
+		NewToken("suki", setKana("スキー"), setPartOfSpeech("名詞"), setOffset(9, 18), setType(TokenTypeMorpheme), setPositionIncrement(2), setKeyword(true)),
+	}}
+
+	for _, order := range permutations(len(filters)) {
+		t.Run(fmt.Sprintf("order = %v", order), func(t *testing.T) {
+			ts := tokenStream
+			for _, i := range order {
+				ts = filters[i].Filter(ts)
+			}
+			if diff := cmp.Diff(NewKanaReadingformFilter().Filter(ts), wantKana); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+			if diff := cmp.Diff(NewRomajiReadingformFilter().Filter(ts), wantRomaji); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+
+	// 元のTokenStreamは変更されない
+	if tokenStream.Tokens[0].Term != "Hakuba" {
+		t.Errorf("input token stream was modified: %v", tokenStream)
+	}
+}
+
+// 0からn-1までの全ての順列
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	result := [][]int{}
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			q := make([]int, 0, n)
+			q = append(q, p[:i]...)
+			q = append(q, n-1)
+			q = append(q, p[i:]...)
+			result = append(result, q)
+		}
+	}
+	return result
+}
+
+func TestFlattenGraphTokenIterator(t *testing.T) {
+	tests := []struct {
+		tokenStream TokenStream
+		want        []uint64
+	}{
+		{
+			// 空いた位置は保つ
+			tokenStream: NewTokenStream([]Token{NewToken("quick", setPositionIncrement(2)), NewToken("fox", setPositionIncrement(2))}),
+			want:        []uint64{1, 3},
+		},
+		{
+			// 経路ごとの途中の位置を重ね、後に続くトークンを最も長い経路の次に置く
+			tokenStream: NewTokenStream([]Token{
+				NewToken("ny", setPositionLength(3)),
+				NewToken("new", setPositionIncrement(0)),
+				NewToken("big", setPositionIncrement(0), setPositionLength(2)),
+				NewToken("york", setPositionLength(2)),
+				NewToken("apple"),
+				NewToken("rocks"),
+			}),
+			want: []uint64{0, 0, 0, 1, 1, 2},
+		},
+		{
+			// 終わるトークンがない位置から始まるトークンがあれば位置の差を保つ
+			tokenStream: NewTokenStream([]Token{
+				NewToken("the quick", setPositionLength(2)),
+				NewToken("quick brown", setPositionLength(2)),
+				NewToken("brown fox", setPositionLength(2)),
+			}),
+			want: []uint64{0, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("tokenStream = %v", tt.tokenStream.Terms()), func(t *testing.T) {
+			got := CollectTokens(newFlattenGraphTokenIterator(tt.tokenStream.Iterator()))
+			for _, token := range got.Tokens {
+				if token.PositionLength > 1 {
+					t.Errorf("PositionLength = %v, want 1", token.PositionLength)
+				}
+			}
+			if diff := cmp.Diff(got.Positions(), tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
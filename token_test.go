@@ -0,0 +1,94 @@
+package stalefish
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenStream_Positions(t *testing.T) {
+	tests := []struct {
+		tokenStream TokenStream
+		want        []uint64
+	}{
+		{
+			tokenStream: TokenStream{Tokens: []Token{{Term: "a", PositionIncrement: 1}, {Term: "b", PositionIncrement: 1}, {Term: "c", PositionIncrement: 1}}},
+			want:        []uint64{0, 1, 2},
+		},
+		{
+			tokenStream: TokenStream{Tokens: []Token{{Term: "a", PositionIncrement: 2}, {Term: "b", PositionIncrement: 3}, {Term: "c", PositionIncrement: 1}}},
+			want:        []uint64{1, 4, 5},
+		},
+		{
+			tokenStream: TokenStream{Tokens: []Token{{Term: "new", PositionIncrement: 1}, {Term: "ny", PositionIncrement: 0}, {Term: "york", PositionIncrement: 1}}},
+			want:        []uint64{0, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("tokenStream = %v", tt.tokenStream.Terms()), func(t *testing.T) {
+			if diff := cmp.Diff(tt.tokenStream.Positions(), tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTokenStream_Paths(t *testing.T) {
+	tests := []struct {
+		tokenStream TokenStream
+		want        [][]string
+	}{
+		{
+			tokenStream: NewTokenStream([]Token{}),
+			want:        [][]string{},
+		},
+		{
+			tokenStream: NewTokenStream([]Token{NewToken("quick"), NewToken("fox", setPositionIncrement(2))}),
+			want:        [][]string{{"quick", "fox"}},
+		},
+		{
+			tokenStream: NewTokenStream([]Token{
+				NewToken("ny", setPositionLength(2)),
+				NewToken("new", setPositionIncrement(0)),
+				NewToken("york"),
+				NewToken("city"),
+			}),
+			want: [][]string{{"ny", "city"}, {"new", "york", "city"}},
+		},
+		{
+			// 異なる経路の途中の位置は共有しない
+			tokenStream: NewTokenStream([]Token{
+				NewToken("a", setPositionLength(1)),
+				NewToken("x", setPositionIncrement(0), setPositionLength(2)),
+				NewToken("b", setPositionLength(2)),
+				NewToken("y", setPositionLength(1)),
+				NewToken("end"),
+			}),
+			want: [][]string{{"a", "b", "end"}, {"x", "y", "end"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("tokenStream = %v", tt.tokenStream.Terms()), func(t *testing.T) {
+			paths := tt.tokenStream.Paths()
+			got := make([][]string, len(paths))
+			for i, path := range paths {
+				got[i] = path.Terms()
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTokenStream_Paths_PositionIncrement(t *testing.T) {
+	tokenStream := NewTokenStream([]Token{NewToken("ny", setPositionLength(2)), NewToken("new", setPositionIncrement(0)), NewToken("york"), NewToken("tour", setPositionIncrement(2))})
+	want := []TokenStream{
+		NewTokenStream([]Token{NewToken("ny", setPositionLength(2)), NewToken("tour", setPositionIncrement(2))}),
+		NewTokenStream([]Token{NewToken("new", setPositionIncrement(0)), NewToken("york"), NewToken("tour", setPositionIncrement(2))}),
+	}
+	if diff := cmp.Diff(tokenStream.Paths(), want); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
@@ -1,9 +1,12 @@
 package stalefish
 
 import (
+	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
+	"github.com/kotaroooo0/gojaconv/jaconv"
 	"github.com/kotaroooo0/stalefish/morphology"
 )
 
@@ -11,21 +14,79 @@ type Tokenizer interface {
 	Tokenize(string) TokenStream
 }
 
+// トークンを1つずつ生成できるTokenizer
+// Analyzer.AnalyzeIteratorは、全てのトークンをスライスにせずに後段のTokenFilterに渡す
+type StreamingTokenizer interface {
+	Tokenizer
+	TokenizeIterator(string) TokenIterator
+}
+
+// StreamingTokenizerでなければ、Tokenizeの結果を順に返す
+func tokenizeIterator(tokenizer Tokenizer, s string) TokenIterator {
+	if st, ok := tokenizer.(StreamingTokenizer); ok {
+		return st.TokenizeIterator(s)
+	}
+	return tokenizer.Tokenize(s).Iterator()
+}
+
 type StandardTokenizer struct{}
 
 func NewStandardTokenizer() StandardTokenizer {
 	return StandardTokenizer{}
 }
 
+// 文字と数字以外で区切る
 func (t StandardTokenizer) Tokenize(s string) TokenStream {
-	terms := strings.FieldsFunc(s, func(r rune) bool {
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-	})
-	tokens := make([]Token, len(terms))
-	for i, term := range terms {
-		tokens[i] = NewToken(term)
+	return CollectTokens(t.TokenizeIterator(s))
+}
+
+func (t StandardTokenizer) TokenizeIterator(s string) TokenIterator {
+	return &standardTokenIterator{s: s}
+}
+
+type standardTokenIterator struct {
+	s     string
+	pos   int // 次に読むルーンの位置(バイト)
+	token Token
+}
+
+func (it *standardTokenIterator) Next() bool {
+	start := -1
+	numeric := true
+	for it.pos < len(it.s) {
+		i := it.pos
+		r, size := utf8.DecodeRuneInString(it.s[i:])
+		it.pos += size
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			if start < 0 {
+				start = i
+				numeric = true
+			}
+			numeric = numeric && unicode.IsNumber(r)
+			continue
+		}
+		if start >= 0 {
+			it.token = newStandardToken(it.s, start, i, numeric)
+			return true
+		}
 	}
-	return NewTokenStream(tokens)
+	if start >= 0 {
+		it.token = newStandardToken(it.s, start, len(it.s), numeric)
+		return true
+	}
+	return false
+}
+
+func (it *standardTokenIterator) Token() Token {
+	return it.token
+}
+
+func newStandardToken(s string, start, end int, numeric bool) Token {
+	typ := TokenTypeAlphanum
+	if numeric {
+		typ = TokenTypeNum
+	}
+	return NewToken(s[start:end], setOffset(start, end), setType(typ))
 }
 
 type MorphologicalTokenizer struct {
@@ -39,14 +100,146 @@ func NewMorphologicalTokenizer(morphology morphology.Morphology) MorphologicalTo
 }
 
 func (t MorphologicalTokenizer) Tokenize(s string) TokenStream {
-	mTokens := t.morphology.Analyze(s)
+	return CollectTokens(t.TokenizeIterator(s))
+}
+
+// 文ごとに形態素解析し、一度に文字列全体の形態素を持たない
+func (t MorphologicalTokenizer) TokenizeIterator(s string) TokenIterator {
+	return &morphologicalTokenIterator{morphology: t.morphology, s: s, index: -1}
+}
+
+type morphologicalTokenIterator struct {
+	morphology morphology.Morphology
+	s          string
+	pos        int     // 次に解析する文の開始位置(バイト)
+	tokens     []Token // 解析した文のトークン
+	index      int
+}
+
+func (it *morphologicalTokenIterator) Next() bool {
+	for it.index+1 >= len(it.tokens) {
+		if it.pos >= len(it.s) {
+			return false
+		}
+		end := sentenceEnd(it.s, it.pos)
+		it.tokens = morphologicalTokens(it.morphology.Analyze(it.s[it.pos:end]), it.s[it.pos:end], it.pos)
+		it.pos = end
+		it.index = -1
+	}
+	it.index++
+	return true
+}
+
+func (it *morphologicalTokenIterator) Token() Token {
+	return it.tokens[it.index]
+}
+
+// 文を区切る文字
+const sentenceDelimiters = "。．！？!?\n"
+
+// startから始まる文の終わりの位置(バイト)を返す
+// 文を区切る文字の連続は直前の文に含める
+func sentenceEnd(s string, start int) int {
+	i := strings.IndexAny(s[start:], sentenceDelimiters)
+	if i < 0 {
+		return len(s)
+	}
+	end := start + i
+	for end < len(s) {
+		r, size := utf8.DecodeRuneInString(s[end:])
+		if !strings.ContainsRune(sentenceDelimiters, r) {
+			break
+		}
+		end += size
+	}
+	return end
+}
+
+// 形態素をトークンにする
+// 形態素は元の文字列に先頭から順に現れるので、探索しながらオフセットを求める
+// オフセットはbaseだけずらす
+func morphologicalTokens(mTokens []morphology.MorphologyToken, s string, base int) []Token {
 	tokens := make([]Token, len(mTokens))
-	for i, t := range mTokens {
-		tokens[i] = NewToken(t.Term, setKana(t.Kana))
+	cursor := 0
+	for i, m := range mTokens {
+		start, end := cursor, cursor
+		if idx := strings.Index(s[cursor:], m.Term); idx >= 0 {
+			start = cursor + idx
+			end = start + len(m.Term)
+			cursor = end
+		}
+		tokens[i] = NewToken(m.Term,
+			setKana(m.Kana),
+			setPartOfSpeech(m.PartOfSpeech),
+			setBaseForm(m.BaseForm),
+			setInflection(m.InflectionType, m.InflectionForm),
+			setOffset(base+start, base+end),
+			setType(TokenTypeMorpheme),
+		)
+	}
+	return tokens
+}
+
+// 読みの表記
+type ReadingForm int
+
+const (
+	ReadingFormKana   ReadingForm = iota + 1 // ひらがな
+	ReadingFormRomaji                        // ヘボン式ローマ字
+)
+
+// 形態素解析で求めた読みを繋げた文字列を、n文字ずつのN-gramに分割する
+// 形態素の分割の仕方によらず読みの一部で検索できるように、形態素の境界をまたいだN-gramも作る
+// 読みがない形態素は表記を読みとし、N-gramのオフセットはN-gramの読みに対応する形態素全体を指す
+type ReadingNgramTokenizer struct {
+	morphology morphology.Morphology
+	form       ReadingForm
+	n          int
+}
+
+func NewReadingNgramTokenizer(morphology morphology.Morphology, form ReadingForm, n int) ReadingNgramTokenizer {
+	return ReadingNgramTokenizer{
+		morphology: morphology,
+		form:       form,
+		n:          n,
+	}
+}
+
+func (t ReadingNgramTokenizer) Tokenize(s string) TokenStream {
+	morphemes := NewMorphologicalTokenizer(t.morphology).Tokenize(s)
+	// 読みの各ルーンと、そのルーンに対応する形態素
+	runes := make([]rune, 0, len(s))
+	owners := make([]int, 0, len(s))
+	for i, m := range morphemes.Tokens {
+		for _, r := range t.reading(m) {
+			runes = append(runes, r)
+			owners = append(owners, i)
+		}
+	}
+	// nより短い読みと、nが正でない時はトークンを生成しない
+	count := len(runes) + 1 - t.n
+	if count < 0 || t.n <= 0 {
+		count = 0
+	}
+	tokens := make([]Token, count)
+	for i := 0; i < count; i++ {
+		first, last := morphemes.Tokens[owners[i]], morphemes.Tokens[owners[i+t.n-1]]
+		tokens[i] = NewToken(string(runes[i:i+t.n]), setOffset(first.Start, last.End), setType(TokenTypeNgram))
 	}
 	return NewTokenStream(tokens)
 }
 
+func (t ReadingNgramTokenizer) reading(token Token) string {
+	kana := token.Kana
+	if kana == "" {
+		kana = token.Term
+	}
+	if t.form == ReadingFormRomaji {
+		return jaconv.ToHebon(jaconv.KatakanaToHiragana(kana))
+	}
+	return jaconv.KatakanaToHiragana(kana)
+}
+
 type NgramTokenizer struct {
 	n int
 }
@@ -58,10 +251,210 @@ func NewNgramTokenizer(n int) NgramTokenizer {
 }
 
 func (t NgramTokenizer) Tokenize(s string) TokenStream {
-	count := len([]rune(s)) + 1 - t.n
-	tokens := make([]Token, count)
-	for i := 0; i < count; i++ {
-		tokens[i] = NewToken(string([]rune(s)[i : i+t.n]))
+	return CollectTokens(t.TokenizeIterator(s))
+}
+
+// 文字列を[]runeに変換せず、n文字の窓を1ルーンずつずらしながら部分文字列をトークンにする
+func (t NgramTokenizer) TokenizeIterator(s string) TokenIterator {
+	return &ngramTokenIterator{s: s, n: t.n, start: -1}
+}
+
+type ngramTokenIterator struct {
+	s     string
+	n     int
+	start int // 現在の窓の開始位置(バイト)。Nextを呼ぶ前は-1
+	end   int // 現在の窓の終了位置(バイト)
+}
+
+func (it *ngramTokenIterator) Next() bool {
+	// nより短い文字列からはトークンを生成しない
+	if it.n <= 0 {
+		return false
+	}
+	if it.start < 0 {
+		it.start = 0
+		for i := 0; i < it.n; i++ {
+			if it.end >= len(it.s) {
+				it.start = len(it.s)
+				return false
+			}
+			_, size := utf8.DecodeRuneInString(it.s[it.end:])
+			it.end += size
+		}
+		return true
+	}
+	if it.end >= len(it.s) {
+		it.start = len(it.s)
+		return false
+	}
+	_, size := utf8.DecodeRuneInString(it.s[it.start:])
+	it.start += size
+	_, size = utf8.DecodeRuneInString(it.s[it.end:])
+	it.end += size
+	return true
+}
+
+func (it *ngramTokenIterator) Token() Token {
+	return NewToken(it.s[it.start:it.end], setOffset(it.start, it.end), setType(TokenTypeNgram))
+}
+
+// エッジN-gramをどちら側から作るか
+type EdgeNgramSide int
+
+const (
+	EdgeNgramFront EdgeNgramSide = iota + 1 // 前方一致(接頭辞)
+	EdgeNgramBack                           // 後方一致(接尾辞)
+)
+
+// 文字列全体から長さmin以上max以下(ルーン数)の接頭辞または接尾辞をトークンにする
+// 入力中に補完するような検索で使う
+type EdgeNgramTokenizer struct {
+	min  int
+	max  int
+	side EdgeNgramSide
+}
+
+func NewEdgeNgramTokenizer(min, max int, side EdgeNgramSide) EdgeNgramTokenizer {
+	return EdgeNgramTokenizer{
+		min:  min,
+		max:  max,
+		side: side,
+	}
+}
+
+func (t EdgeNgramTokenizer) Tokenize(s string) TokenStream {
+	// 各ルーンの開始位置(バイト)
+	offsets := make([]int, 0, len(s)+1)
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(s))
+	n := len(offsets) - 1
+	tokens := make([]Token, 0)
+	for _, l := range edgeNgramLengths(n, t.min, t.max) {
+		start, end := offsets[0], offsets[l]
+		if t.side == EdgeNgramBack {
+			start, end = offsets[n-l], offsets[n]
+		}
+		tokens = append(tokens, NewToken(s[start:end], setOffset(start, end), setType(TokenTypeNgram)))
 	}
 	return NewTokenStream(tokens)
 }
+
+// n文字から作るエッジN-gramの長さを短い順に返す
+// minより短い場合は空になる
+func edgeNgramLengths(n, min, max int) []int {
+	if min < 1 {
+		min = 1
+	}
+	if max > n {
+		max = n
+	}
+	lengths := make([]int, 0)
+	for l := min; l <= max; l++ {
+		lengths = append(lengths, l)
+	}
+	return lengths
+}
+
+// 漢字、ひらがな、カタカナ、ハングルの連続は2文字ずつ区切り、それ以外の文字と数字の連続は一つのトークンにする
+// 辞書を使わないので形態素解析より未知語に強く、再現率を重視する時に使う
+type CJKBigramTokenizer struct{}
+
+func NewCJKBigramTokenizer() CJKBigramTokenizer {
+	return CJKBigramTokenizer{}
+}
+
+func (t CJKBigramTokenizer) Tokenize(s string) TokenStream {
+	tokens := make([]Token, 0)
+	// 同じ種類の文字の連続の各ルーンの開始位置(バイト)
+	run := make([]int, 0)
+	runCJK := false
+	flush := func(end int) {
+		if len(run) == 0 {
+			return
+		}
+		switch {
+		case !runCJK:
+			tokens = append(tokens, newStandardToken(s, run[0], end, isNumeric(s[run[0]:end])))
+		case len(run) == 1:
+			tokens = append(tokens, NewToken(s[run[0]:end], setOffset(run[0], end), setType(TokenTypeCJK)))
+		default:
+			offsets := append(run, end)
+			for i := 0; i+2 < len(offsets); i++ {
+				tokens = append(tokens, NewToken(s[offsets[i]:offsets[i+2]], setOffset(offsets[i], offsets[i+2]), setType(TokenTypeCJK)))
+			}
+		}
+		run = run[:0]
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && !isCJK(r) {
+			flush(i)
+			continue
+		}
+		if len(run) > 0 && isCJK(r) != runCJK {
+			flush(i)
+		}
+		runCJK = isCJK(r)
+		run = append(run, i)
+	}
+	flush(len(s))
+	return NewTokenStream(tokens)
+}
+
+// 長音記号(ー)は文字種としては共通だが、カタカナと一緒に扱う
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || r == 'ー' || r == 'ｰ'
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if !unicode.IsNumber(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// 正規表現でトークンに分割するTokenizer
+// groupが負ならマッチした部分で区切り、0以上ならマッチした部分のうちgroup番目のグループをトークンにする
+type PatternTokenizer struct {
+	pattern *regexp.Regexp
+	group   int
+}
+
+func NewPatternTokenizer(pattern *regexp.Regexp, group int) PatternTokenizer {
+	return PatternTokenizer{
+		pattern: pattern,
+		group:   group,
+	}
+}
+
+func (t PatternTokenizer) Tokenize(s string) TokenStream {
+	tokens := make([]Token, 0)
+	matches := t.pattern.FindAllStringSubmatchIndex(s, -1)
+	if t.group < 0 {
+		prev := 0
+		for _, m := range matches {
+			tokens = appendPatternToken(tokens, s, prev, m[0])
+			prev = m[1]
+		}
+		tokens = appendPatternToken(tokens, s, prev, len(s))
+		return NewTokenStream(tokens)
+	}
+	for _, m := range matches {
+		// マッチしなかったグループは-1になる
+		if 2*t.group+1 < len(m) && m[2*t.group] >= 0 {
+			tokens = appendPatternToken(tokens, s, m[2*t.group], m[2*t.group+1])
+		}
+	}
+	return NewTokenStream(tokens)
+}
+
+// 空のトークンは追加しない
+func appendPatternToken(tokens []Token, s string, start, end int) []Token {
+	if start >= end {
+		return tokens
+	}
+	return append(tokens, NewToken(s[start:end], setOffset(start, end), setType(TokenTypePattern)))
+}
@@ -3,6 +3,7 @@ package stalefish
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 	"testing"
 
 	gomock "github.com/golang/mock/gomock"
@@ -19,11 +20,11 @@ func TestMorphologicalTokenizerTokenize(t *testing.T) {
 			text: "今日は天気が良い",
 			expected: TokenStream{
 				Tokens: []Token{
-					{Term: "今日", Kana: "キョウ"},
-					{Term: "は", Kana: "ハ"},
-					{Term: "天気", Kana: "テンキ"},
-					{Term: "が", Kana: "ガ"},
-					{Term: "良い", Kana: "ヨイ"},
+					NewToken("今日", setKana("キョウ"), setPartOfSpeech("名詞-副詞可能"), setBaseForm("今日"), setOffset(0, 6), setType(TokenTypeMorpheme)),
+					NewToken("は", setKana("ハ"), setPartOfSpeech("助詞-係助詞"), setBaseForm("は"), setOffset(6, 9), setType(TokenTypeMorpheme)),
+					NewToken("天気", setKana("テンキ"), setPartOfSpeech("名詞-一般"), setBaseForm("天気"), setOffset(9, 15), setType(TokenTypeMorpheme)),
+					NewToken("が", setKana("ガ"), setPartOfSpeech("助詞-格助詞-一般"), setBaseForm("が"), setOffset(15, 18), setType(TokenTypeMorpheme)),
+					NewToken("良い", setKana("ヨイ"), setPartOfSpeech("形容詞-自立"), setBaseForm("良い"), setInflection("形容詞・アウオ段", "基本形"), setOffset(18, 24), setType(TokenTypeMorpheme)),
 				},
 			},
 		},
@@ -39,11 +40,11 @@ func TestMorphologicalTokenizerTokenize(t *testing.T) {
 			// Given
 			tokenizer := NewMorphologicalTokenizer(mockMorphology)
 			mockMorphology.EXPECT().Analyze(tt.text).Return([]morphology.MorphologyToken{
-				morphology.NewMorphologyToken("今日", "キョウ"),
-				morphology.NewMorphologyToken("は", "ハ"),
-				morphology.NewMorphologyToken("天気", "テンキ"),
-				morphology.NewMorphologyToken("が", "ガ"),
-				morphology.NewMorphologyToken("良い", "ヨイ"),
+				morphology.NewMorphologyToken("今日", "キョウ", morphology.WithPartOfSpeech("名詞-副詞可能"), morphology.WithBaseForm("今日")),
+				morphology.NewMorphologyToken("は", "ハ", morphology.WithPartOfSpeech("助詞-係助詞"), morphology.WithBaseForm("は")),
+				morphology.NewMorphologyToken("天気", "テンキ", morphology.WithPartOfSpeech("名詞-一般"), morphology.WithBaseForm("天気")),
+				morphology.NewMorphologyToken("が", "ガ", morphology.WithPartOfSpeech("助詞-格助詞-一般"), morphology.WithBaseForm("が")),
+				morphology.NewMorphologyToken("良い", "ヨイ", morphology.WithPartOfSpeech("形容詞-自立"), morphology.WithBaseForm("良い"), morphology.WithInflection("形容詞・アウオ段", "基本形")),
 			})
 
 			// When
@@ -57,6 +58,108 @@ func TestMorphologicalTokenizerTokenize(t *testing.T) {
 	}
 }
 
+// 文ごとに形態素解析し、後段が読んだ文の分だけ解析する
+func TestMorphologicalTokenizer_TokenizeIterator(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockMorphology := NewMockMorphology(mockCtrl)
+	mockMorphology.EXPECT().Analyze("白馬。").Return([]morphology.MorphologyToken{
+		morphology.NewMorphologyToken("白馬", "ハクバ"),
+		morphology.NewMorphologyToken("。", "。"),
+	})
+
+	text := "白馬。石打!?\n丸山"
+	it := NewMorphologicalTokenizer(mockMorphology).TokenizeIterator(text)
+	first := make([]Token, 0)
+	for len(first) < 2 && it.Next() {
+		first = append(first, it.Token())
+	}
+
+	mockMorphology.EXPECT().Analyze("石打!?\n").Return([]morphology.MorphologyToken{
+		morphology.NewMorphologyToken("石打", "イシウチ"),
+		morphology.NewMorphologyToken("!?", "!?"),
+	})
+	mockMorphology.EXPECT().Analyze("丸山").Return([]morphology.MorphologyToken{
+		morphology.NewMorphologyToken("丸山", "マルヤマ"),
+	})
+	actual := append(first, CollectTokens(it).Tokens...)
+
+	expected := []Token{
+		NewToken("白馬", setKana("ハクバ"), setOffset(0, 6), setType(TokenTypeMorpheme)),
+		NewToken("。", setKana("。"), setOffset(6, 9), setType(TokenTypeMorpheme)),
+		NewToken("石打", setKana("イシウチ"), setOffset(9, 15), setType(TokenTypeMorpheme)),
+		NewToken("!?", setKana("!?"), setOffset(15, 17), setType(TokenTypeMorpheme)),
+		NewToken("丸山", setKana("マルヤマ"), setOffset(18, 24), setType(TokenTypeMorpheme)),
+	}
+	if diff := cmp.Diff(actual, expected); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestReadingNgramTokenizer_Tokenize(t *testing.T) {
+	cases := []struct {
+		form     ReadingForm
+		n        int
+		expected TokenStream
+	}{
+		{
+			form: ReadingFormKana,
+			n:    2,
+			expected: NewTokenStream([]Token{
+				NewToken("はく", setOffset(0, 6), setType(TokenTypeNgram)),
+				NewToken("くば", setOffset(0, 6), setType(TokenTypeNgram)),
+				NewToken("ばむ", setOffset(0, 9), setType(TokenTypeNgram)),
+				NewToken("むら", setOffset(6, 9), setType(TokenTypeNgram)),
+				NewToken("らg", setOffset(6, 11), setType(TokenTypeNgram)),
+				NewToken("go", setOffset(9, 11), setType(TokenTypeNgram)),
+			}),
+		},
+		{
+			form: ReadingFormRomaji,
+			n:    5,
+			expected: NewTokenStream([]Token{
+				NewToken("hakub", setOffset(0, 6), setType(TokenTypeNgram)),
+				NewToken("akuba", setOffset(0, 6), setType(TokenTypeNgram)),
+				NewToken("kubam", setOffset(0, 9), setType(TokenTypeNgram)),
+				NewToken("ubamu", setOffset(0, 9), setType(TokenTypeNgram)),
+				NewToken("bamur", setOffset(0, 9), setType(TokenTypeNgram)),
+				NewToken("amura", setOffset(0, 9), setType(TokenTypeNgram)),
+				NewToken("murag", setOffset(6, 11), setType(TokenTypeNgram)),
+				NewToken("urago", setOffset(6, 11), setType(TokenTypeNgram)),
+			}),
+		},
+		{
+			form:     ReadingFormKana,
+			n:        10,
+			expected: NewTokenStream([]Token{}),
+		},
+		{
+			form:     ReadingFormKana,
+			n:        0,
+			expected: NewTokenStream([]Token{}),
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(fmt.Sprintf("form = %v, n = %v, expected = %v", tt.form, tt.n, tt.expected), func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			mockMorphology := NewMockMorphology(mockCtrl)
+			mockMorphology.EXPECT().Analyze("白馬村go").Return([]morphology.MorphologyToken{
+				morphology.NewMorphologyToken("白馬", "ハクバ"),
+				morphology.NewMorphologyToken("村", "ムラ"),
+				morphology.NewMorphologyToken("go", ""),
+			})
+
+			actual := NewReadingNgramTokenizer(mockMorphology, tt.form, tt.n).Tokenize("白馬村go")
+
+			if diff := cmp.Diff(actual, tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestNgramTokenizer_Tokenize(t *testing.T) {
 	tests := []struct {
 		n        int
@@ -64,40 +167,89 @@ func TestNgramTokenizer_Tokenize(t *testing.T) {
 		expected TokenStream
 	}{
 		{
-			n:        1,
-			text:     "hogefuga",
-			expected: TokenStream{Tokens: []Token{{Term: "h"}, {Term: "o"}, {Term: "g"}, {Term: "e"}, {Term: "f"}, {Term: "u"}, {Term: "g"}, {Term: "a"}}},
+			n:    1,
+			text: "hogefuga",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("h", setOffset(0, 1), setType(TokenTypeNgram)),
+				NewToken("o", setOffset(1, 2), setType(TokenTypeNgram)),
+				NewToken("g", setOffset(2, 3), setType(TokenTypeNgram)),
+				NewToken("e", setOffset(3, 4), setType(TokenTypeNgram)),
+				NewToken("f", setOffset(4, 5), setType(TokenTypeNgram)),
+				NewToken("u", setOffset(5, 6), setType(TokenTypeNgram)),
+				NewToken("g", setOffset(6, 7), setType(TokenTypeNgram)),
+				NewToken("a", setOffset(7, 8), setType(TokenTypeNgram)),
+			}},
 		},
 		{
-			n:        2,
-			text:     "hogefuga",
-			expected: TokenStream{Tokens: []Token{{Term: "ho"}, {Term: "og"}, {Term: "ge"}, {Term: "ef"}, {Term: "fu"}, {Term: "ug"}, {Term: "ga"}}},
+			n:    2,
+			text: "hogefuga",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("ho", setOffset(0, 2), setType(TokenTypeNgram)),
+				NewToken("og", setOffset(1, 3), setType(TokenTypeNgram)),
+				NewToken("ge", setOffset(2, 4), setType(TokenTypeNgram)),
+				NewToken("ef", setOffset(3, 5), setType(TokenTypeNgram)),
+				NewToken("fu", setOffset(4, 6), setType(TokenTypeNgram)),
+				NewToken("ug", setOffset(5, 7), setType(TokenTypeNgram)),
+				NewToken("ga", setOffset(6, 8), setType(TokenTypeNgram)),
+			}},
 		},
 		{
-			n:        3,
-			text:     "hogefuga",
-			expected: TokenStream{Tokens: []Token{{Term: "hog"}, {Term: "oge"}, {Term: "gef"}, {Term: "efu"}, {Term: "fug"}, {Term: "uga"}}},
+			n:    3,
+			text: "hogefuga",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("hog", setOffset(0, 3), setType(TokenTypeNgram)),
+				NewToken("oge", setOffset(1, 4), setType(TokenTypeNgram)),
+				NewToken("gef", setOffset(2, 5), setType(TokenTypeNgram)),
+				NewToken("efu", setOffset(3, 6), setType(TokenTypeNgram)),
+				NewToken("fug", setOffset(4, 7), setType(TokenTypeNgram)),
+				NewToken("uga", setOffset(5, 8), setType(TokenTypeNgram)),
+			}},
 		},
 		{
-			n:        1,
-			text:     "日本昔ばなし",
-			expected: TokenStream{Tokens: []Token{{Term: "日"}, {Term: "本"}, {Term: "昔"}, {Term: "ば"}, {Term: "な"}, {Term: "し"}}},
+			n:    1,
+			text: "日本昔ばなし",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("日", setOffset(0, 3), setType(TokenTypeNgram)),
+				NewToken("本", setOffset(3, 6), setType(TokenTypeNgram)),
+				NewToken("昔", setOffset(6, 9), setType(TokenTypeNgram)),
+				NewToken("ば", setOffset(9, 12), setType(TokenTypeNgram)),
+				NewToken("な", setOffset(12, 15), setType(TokenTypeNgram)),
+				NewToken("し", setOffset(15, 18), setType(TokenTypeNgram)),
+			}},
 		},
 		{
-			n:        2,
-			text:     "日本昔ばなし",
-			expected: TokenStream{Tokens: []Token{{Term: "日本"}, {Term: "本昔"}, {Term: "昔ば"}, {Term: "ばな"}, {Term: "なし"}}},
+			n:    2,
+			text: "日本昔ばなし",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("日本", setOffset(0, 6), setType(TokenTypeNgram)),
+				NewToken("本昔", setOffset(3, 9), setType(TokenTypeNgram)),
+				NewToken("昔ば", setOffset(6, 12), setType(TokenTypeNgram)),
+				NewToken("ばな", setOffset(9, 15), setType(TokenTypeNgram)),
+				NewToken("なし", setOffset(12, 18), setType(TokenTypeNgram)),
+			}},
 		},
 		{
-			n:        6,
-			text:     "日本昔ばなし",
-			expected: TokenStream{Tokens: []Token{{Term: "日本昔ばなし"}}},
+			n:    6,
+			text: "日本昔ばなし",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("日本昔ばなし", setOffset(0, 18), setType(TokenTypeNgram)),
+			}},
 		},
 		{
 			n:        7,
 			text:     "日本昔ばなし",
 			expected: TokenStream{Tokens: []Token{}},
 		},
+		{
+			n:        3,
+			text:     "a",
+			expected: TokenStream{Tokens: []Token{}},
+		},
+		{
+			n:        2,
+			text:     "",
+			expected: TokenStream{Tokens: []Token{}},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(fmt.Sprintf("n = %v, text = %v, expected = %v", tt.n, tt.text, tt.expected), func(t *testing.T) {
@@ -110,3 +262,181 @@ func TestNgramTokenizer_Tokenize(t *testing.T) {
 		})
 	}
 }
+
+func TestStandardTokenizer_Tokenize(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected TokenStream
+	}{
+		{
+			text:     "",
+			expected: TokenStream{Tokens: []Token{}},
+		},
+		{
+			text: "Go 1.16, 白馬!",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("Go", setOffset(0, 2), setType(TokenTypeAlphanum)),
+				NewToken("1", setOffset(3, 4), setType(TokenTypeNum)),
+				NewToken("16", setOffset(5, 7), setType(TokenTypeNum)),
+				NewToken("白馬", setOffset(9, 15), setType(TokenTypeAlphanum)),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("text = %v, expected = %v", tt.text, tt.expected), func(t *testing.T) {
+			if diff := cmp.Diff(NewStandardTokenizer().Tokenize(tt.text), tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEdgeNgramTokenizer_Tokenize(t *testing.T) {
+	tests := []struct {
+		min, max int
+		side     EdgeNgramSide
+		text     string
+		expected TokenStream
+	}{
+		{
+			min: 1, max: 3, side: EdgeNgramFront,
+			text: "apple",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("a", setOffset(0, 1), setType(TokenTypeNgram)),
+				NewToken("ap", setOffset(0, 2), setType(TokenTypeNgram)),
+				NewToken("app", setOffset(0, 3), setType(TokenTypeNgram)),
+			}},
+		},
+		{
+			min: 2, max: 3, side: EdgeNgramBack,
+			text: "apple",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("le", setOffset(3, 5), setType(TokenTypeNgram)),
+				NewToken("ple", setOffset(2, 5), setType(TokenTypeNgram)),
+			}},
+		},
+		{
+			min: 1, max: 10, side: EdgeNgramFront,
+			text: "白馬",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("白", setOffset(0, 3), setType(TokenTypeNgram)),
+				NewToken("白馬", setOffset(0, 6), setType(TokenTypeNgram)),
+			}},
+		},
+		{
+			min: 3, max: 5, side: EdgeNgramFront,
+			text:     "go",
+			expected: TokenStream{Tokens: []Token{}},
+		},
+		{
+			min: 1, max: 2, side: EdgeNgramBack,
+			text:     "",
+			expected: TokenStream{Tokens: []Token{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("min = %v, max = %v, side = %v, text = %v", tt.min, tt.max, tt.side, tt.text), func(t *testing.T) {
+			tokenizer := NewEdgeNgramTokenizer(tt.min, tt.max, tt.side)
+			if diff := cmp.Diff(tokenizer.Tokenize(tt.text), tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCJKBigramTokenizer_Tokenize(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected TokenStream
+	}{
+		{
+			text:     "",
+			expected: TokenStream{Tokens: []Token{}},
+		},
+		{
+			text: "東京都",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("東京", setOffset(0, 6), setType(TokenTypeCJK)),
+				NewToken("京都", setOffset(3, 9), setType(TokenTypeCJK)),
+			}},
+		},
+		{
+			text: "iPhone用ケース 2個",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("iPhone", setOffset(0, 6), setType(TokenTypeAlphanum)),
+				NewToken("用ケ", setOffset(6, 12), setType(TokenTypeCJK)),
+				NewToken("ケー", setOffset(9, 15), setType(TokenTypeCJK)),
+				NewToken("ース", setOffset(12, 18), setType(TokenTypeCJK)),
+				NewToken("2", setOffset(19, 20), setType(TokenTypeNum)),
+				NewToken("個", setOffset(20, 23), setType(TokenTypeCJK)),
+			}},
+		},
+		{
+			text: "Go言語、서울 2021",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("Go", setOffset(0, 2), setType(TokenTypeAlphanum)),
+				NewToken("言語", setOffset(2, 8), setType(TokenTypeCJK)),
+				NewToken("서울", setOffset(11, 17), setType(TokenTypeCJK)),
+				NewToken("2021", setOffset(18, 22), setType(TokenTypeNum)),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("text = %v", tt.text), func(t *testing.T) {
+			if diff := cmp.Diff(NewCJKBigramTokenizer().Tokenize(tt.text), tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPatternTokenizer_Tokenize(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		group    int
+		text     string
+		expected TokenStream
+	}{
+		{
+			pattern:  `,\s*`,
+			group:    -1,
+			text:     "",
+			expected: TokenStream{Tokens: []Token{}},
+		},
+		{
+			pattern: `,\s*`,
+			group:   -1,
+			text:    "go, ruby,,php, ",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("go", setOffset(0, 2), setType(TokenTypePattern)),
+				NewToken("ruby", setOffset(4, 8), setType(TokenTypePattern)),
+				NewToken("php", setOffset(10, 13), setType(TokenTypePattern)),
+			}},
+		},
+		{
+			pattern: `#(\w+)`,
+			group:   1,
+			text:    "#go is #fun",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("go", setOffset(1, 3), setType(TokenTypePattern)),
+				NewToken("fun", setOffset(8, 11), setType(TokenTypePattern)),
+			}},
+		},
+		{
+			pattern: `[0-9]+`,
+			group:   0,
+			text:    "白馬 1998 長野",
+			expected: TokenStream{Tokens: []Token{
+				NewToken("1998", setOffset(7, 11), setType(TokenTypePattern)),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("pattern = %v, group = %v, text = %v", tt.pattern, tt.group, tt.text), func(t *testing.T) {
+			tokenizer := NewPatternTokenizer(regexp.MustCompile(tt.pattern), tt.group)
+			if diff := cmp.Diff(tokenizer.Tokenize(tt.text), tt.expected); diff != "" {
+				t.Errorf("Diff: (-got +want)\n%s", diff)
+			}
+		})
+	}
+}
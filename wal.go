@@ -0,0 +1,273 @@
+package stalefish
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WAL(Write Ahead Log)
+// ストレージへマージされていないドキュメントを記録し、再起動時にメモリ上の転置インデックスを復元する
+// レコードは [ペイロード長(4byte)][CRC32(4byte)][Gobでシリアライズしたペイロード] の形式で追記される
+type WAL struct {
+	file *os.File
+	path string
+}
+
+type walRecordKind int
+
+const (
+	walDocument walRecordKind = iota // IDが確定したドキュメント
+	walBegin                         // ストレージに保存する前のドキュメント
+	walCommit                        // 直前のwalBeginのドキュメントをストレージに保存したときのID
+)
+
+type walRecord struct {
+	Kind       walRecordKind
+	DocumentID DocumentID
+	Body       string
+	Count      int // walBeginを記録した時点のストレージのドキュメント数
+}
+
+// ストレージへの保存を完了していないドキュメント
+type walPending struct {
+	Body  string
+	Count int // 記録した時点のストレージのドキュメント数
+}
+
+// 書き込み途中でクラッシュした末尾のレコードがあれば、最後の正しいレコードまでに切り詰める
+// 壊れたレコードの後ろに追記すると、以降のレコードが全て読めなくなるため
+func OpenWAL(path string) (*WAL, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &WAL{
+		file: file,
+		path: path,
+	}
+	end, err := w.readRecords(nil)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	size, err := w.Size()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if end < size {
+		if err := file.Truncate(end); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// IDが確定したドキュメントをWALに追記し、ディスクへ同期する
+func (w *WAL) Append(doc Document) error {
+	return w.append(walRecord{Kind: walDocument, DocumentID: doc.ID, Body: doc.Body})
+}
+
+// ストレージに保存する前のドキュメントを追記し、取り消し用に追記前のサイズを返す
+// countはストレージのドキュメント数で、保存の途中でクラッシュした時に保存済みかどうかの判定に使う
+func (w *WAL) Begin(body string, count int) (int64, error) {
+	size, err := w.Size()
+	if err != nil {
+		return 0, err
+	}
+	return size, w.append(walRecord{Kind: walBegin, Body: body, Count: count})
+}
+
+// 直前にBeginで追記したドキュメントをストレージに保存した時のIDを追記する
+func (w *WAL) Commit(id DocumentID) error {
+	return w.append(walRecord{Kind: walCommit, DocumentID: id})
+}
+
+// Beginで追記したドキュメントのストレージへの保存に失敗した時に、Beginが返したサイズまでに切り詰める
+func (w *WAL) Rollback(size int64) error {
+	if err := w.file.Truncate(size); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+func (w *WAL) append(record walRecord) error {
+	payload := bytes.NewBuffer(nil)
+	if err := gob.NewEncoder(payload).Encode(record); err != nil {
+		return err
+	}
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	if _, err := w.file.Write(append(header, payload.Bytes()...)); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// WALに記録されたIDが確定したドキュメントを先頭から順に読み出す
+// 書き込み途中でクラッシュした末尾のレコードは読み捨てる
+func (w *WAL) Replay(fn func(Document) error) error {
+	_, err := w.replay(fn)
+	return err
+}
+
+// Replayに加えて、末尾にストレージへの保存を完了していないドキュメントがあれば返す
+func (w *WAL) replay(fn func(Document) error) (*walPending, error) {
+	var pending *walPending
+	_, err := w.readRecords(func(record walRecord) error {
+		switch record.Kind {
+		case walBegin:
+			pending = &walPending{Body: record.Body, Count: record.Count}
+			return nil
+		case walCommit:
+			if pending == nil {
+				return nil
+			}
+			body := pending.Body
+			pending = nil
+			return fn(Document{ID: record.DocumentID, Body: body})
+		default:
+			return fn(Document{ID: record.DocumentID, Body: record.Body})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// 先頭から正しいレコードを読み、fnがnilでなければレコードを渡す
+// 最後に読めた正しいレコードの終わりのオフセットを返す
+func (w *WAL) readRecords(fn func(walRecord) error) (int64, error) {
+	size, err := w.Size()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(w.file)
+	header := make([]byte, 8)
+	var end int64
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return end, nil
+			}
+			return end, err
+		}
+		// 壊れたペイロード長で大きな領域を確保しないように、ファイルの残りより長ければ途中で途切れたとみなす
+		length := int64(binary.BigEndian.Uint32(header[0:4]))
+		if end+int64(len(header))+length > size {
+			return end, nil
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return end, nil
+			}
+			return end, err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return end, nil
+		}
+
+		var record walRecord
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			return end, err
+		}
+		end += int64(len(header) + len(payload))
+		if fn == nil {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return end, err
+		}
+	}
+}
+
+// ストレージへのマージが完了した時にWALを空にする
+func (w *WAL) Truncate() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// WALの現在のサイズを返す
+// TruncateBeforeに渡すことで、それ以前に追記されたレコードのみを削除できる
+func (w *WAL) Size() (int64, error) {
+	info, err := w.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// offsetより前に追記されたレコードを削除し、それ以降のレコードのみを残す
+// 残すレコードを一時ファイルに書いてディスクへ同期してからWALと置き換えるので、途中でクラッシュしてもレコードは失われない
+func (w *WAL) TruncateBefore(offset int64) error {
+	if _, err := w.file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	rest, err := ioutil.ReadAll(w.file)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return w.Truncate()
+	}
+
+	// 一時ファイルのハンドルはリネーム後もWALのファイルを指すので、以降の追記に使う
+	tmp := w.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(rest); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		file.Close()
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	return syncDir(filepath.Dir(w.path))
+}
+
+// ディレクトリをディスクへ同期し、ファイルの作成・リネーム・削除を永続化する
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
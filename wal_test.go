@@ -0,0 +1,217 @@
+package stalefish
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWAL_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stalefish.wal")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := []Document{{ID: 1, Body: "aa bb"}, {ID: 2, Body: "白馬 スキー"}}
+	for _, doc := range docs {
+		if err := wal.Append(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 書き込み途中でクラッシュしたレコードを再現
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 0, 42, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// 再起動後にWALを開き直して読み出す
+	wal, err = OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	var replayed []Document
+	if err := wal.Replay(func(doc Document) error {
+		replayed = append(replayed, doc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(replayed, docs); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+
+	// 空にした後は何も読み出されない
+	if err := wal.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Replay(func(doc Document) error {
+		t.Errorf("unexpected replay: %v", doc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWAL_TruncateBefore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stalefish.wal")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	// Given: マージ開始時点までに2件、マージ中に1件追記
+	for _, doc := range []Document{{ID: 1, Body: "aa"}, {ID: 2, Body: "bb"}} {
+		if err := wal.Append(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkpoint, err := wal.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Append(Document{ID: 3, Body: "cc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	if err := wal.TruncateBefore(checkpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Append(Document{ID: 4, Body: "dd"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then
+	var replayed []Document
+	if err := wal.Replay(func(doc Document) error {
+		replayed = append(replayed, doc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(replayed, []Document{{ID: 3, Body: "cc"}, {ID: 4, Body: "dd"}}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+
+	// 置き換えたファイルに追記されていて、開き直しても同じレコードが読める
+	reopened, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	replayed = nil
+	if err := reopened.Replay(func(doc Document) error {
+		replayed = append(replayed, doc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(replayed, []Document{{ID: 3, Body: "cc"}, {ID: 4, Body: "dd"}}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file remains: %v", err)
+	}
+}
+
+func TestOpenWAL_TruncateTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stalefish.wal")
+	wal, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Append(Document{ID: 1, Body: "aa"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Given: 書き込み途中でクラッシュしたレコード
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 0, 42, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// When: Replayせずに開き直して追記する
+	wal, err = OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+	if err := wal.Append(Document{ID: 2, Body: "bb"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then: 壊れたレコードの後に追記したレコードも読み出せる
+	var replayed []Document
+	if err := wal.Replay(func(doc Document) error {
+		replayed = append(replayed, doc)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(replayed, []Document{{ID: 1, Body: "aa"}, {ID: 2, Body: "bb"}}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}
+
+func TestWAL_BeginCommit(t *testing.T) {
+	wal, err := OpenWAL(filepath.Join(t.TempDir(), "stalefish.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	// Given: 保存に成功、失敗、保存中にクラッシュ
+	if _, err := wal.Begin("aa", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+	size, err := wal.Begin("bb", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.Rollback(size); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.Begin("cc", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// When
+	var replayed []Document
+	pending, err := wal.replay(func(doc Document) error {
+		replayed = append(replayed, doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Then
+	if diff := cmp.Diff(replayed, []Document{{ID: 1, Body: "aa"}}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+	if diff := cmp.Diff(pending, &walPending{Body: "cc", Count: 1}); diff != "" {
+		t.Errorf("Diff: (-got +want)\n%s", diff)
+	}
+}